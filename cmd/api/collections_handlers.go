@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"openmovies/internal/data"
+	"strconv"
+)
+
+type CollectionDto struct {
+	Name        string `json:"name" validate:"required,max=500"`
+	Description string `json:"description" validate:"max=20000"`
+	ParentID    *int64 `json:"parentId" validate:"omitnil,min=1"`
+	Position    int32  `json:"position" validate:"min=0"`
+}
+
+func (app *application) getCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	input := data.NewCollectionFilters()
+	err := app.schemaDecoder.Decode(&input, r.URL.Query())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	collections, metadata, err := app.models.Collections.Get(input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"collections": collections, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkCollectionParent makes sure a referenced parent collection exists. It
+// writes the error response itself and returns false otherwise.
+func (app *application) checkCollectionParent(w http.ResponseWriter, r *http.Request, parentId *int64) bool {
+	if parentId == nil {
+		return true
+	}
+	_, err := app.models.Collections.GetById(*parentId)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.fieldValidationResponse(w, r, []apiError{
+				{Field: "parentId", Message: "parent collection does not exist"},
+			})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+	return true
+}
+
+func (app *application) postCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	var input CollectionDto
+	err := app.decodeJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+	if !app.checkCollectionParent(w, r, input.ParentID) {
+		return
+	}
+
+	collection := &data.Collection{
+		Name:        input.Name,
+		Description: input.Description,
+		ParentID:    input.ParentID,
+		Position:    input.Position,
+	}
+	err = app.models.Collections.Insert(collection)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/collections/%d", collection.ID))
+
+	err = app.writeJson(w, http.StatusCreated, envelop{"collection": collection}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	collection, err := app.models.Collections.GetById(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"collection": collection}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) putCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	collection, err := app.models.Collections.GetById(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input CollectionDto
+	err = app.decodeJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+	if !app.checkCollectionParent(w, r, input.ParentID) {
+		return
+	}
+
+	collection.Name = input.Name
+	collection.Description = input.Description
+	collection.ParentID = input.ParentID
+	collection.Position = input.Position
+
+	err = app.models.Collections.Update(collection)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrCollectionCycle):
+			app.fieldValidationResponse(w, r, []apiError{
+				{Field: "parentId", Message: "a collection cannot be nested inside itself"},
+			})
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"collection": collection}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Collections.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"message": fmt.Sprintf("collection with id: %d was deleted", id)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) putCollectionMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		MovieIDs []int64 `json:"movieIds" validate:"required,unique,max=1000,dive,min=1"`
+	}
+	err = app.decodeJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	collection, err := app.models.Collections.GetById(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Collections.SetMovies(collection.ID, input.MovieIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.fieldValidationResponse(w, r, []apiError{
+				{Field: "movieIds", Message: "every movie must exist"},
+			})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	collection, err = app.models.Collections.GetById(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"collection": collection}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
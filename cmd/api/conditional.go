@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"openmovies/internal/data"
+	"strings"
+	"time"
+)
+
+// movieETag tags one variant of a movie representation: the version plus a
+// hash of what the variant was rendered with, so the bodies negotiated for
+// different Accept-Language headers never share a tag. The rating summary
+// goes into the hash as well, since it changes without a new version.
+func movieETag(movie *data.Movie) string {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s\x00%s\x00%d\x00%g", movie.TitleLocale, movie.TranslationLocale, movie.RatingCount, movie.Rating)
+	return fmt.Sprintf(`"%d-%d-%08x"`, movie.ID, movie.Version, h.Sum32())
+}
+
+// versionMatches reports whether etag was issued for the version of movie,
+// whichever variant it tagged. Plain "id-version" tags match too.
+func versionMatches(etag string, movie *data.Movie) bool {
+	version := fmt.Sprintf(`"%d-%d`, movie.ID, movie.Version)
+	return etag == version+`"` || strings.HasPrefix(etag, version+"-")
+}
+
+func setMovieValidators(headers http.Header, movie *data.Movie) {
+	headers.Set("ETag", movieETag(movie))
+	headers.Set("Last-Modified", movie.UpdatedAt.UTC().Format(http.TimeFormat))
+}
+
+// etagListMatches reports whether etag appears in an If-Match or If-None-Match
+// header value. Weak comparison ignores the W/ prefix, strong comparison never
+// matches a weak tag.
+func etagListMatches(header string, etag string, weak bool) bool {
+	return etagListMatchesFunc(header, func(candidate string) bool { return candidate == etag }, weak)
+}
+
+// etagListMatchesFunc is etagListMatches for any tag that match accepts.
+func etagListMatchesFunc(header string, match func(etag string) bool, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		} else if strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+		if match(candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified reports whether a GET for movie can be answered with 304.
+func notModified(r *http.Request, movie *data.Movie) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		return etagListMatches(header, movieETag(movie), true)
+	}
+	if header := r.Header.Get("If-Modified-Since"); header != "" {
+		since, err := http.ParseTime(header)
+		if err != nil {
+			return false
+		}
+		return !movie.UpdatedAt.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+// checkIfMatch evaluates the If-Match precondition of a write against the
+// current version of movie, whatever variant the client read it in. It writes
+// the error response itself and returns ok == false when the request must not
+// proceed. conditional tells whether the client sent a precondition at all.
+func (app *application) checkIfMatch(w http.ResponseWriter, r *http.Request, movie *data.Movie) (ok bool, conditional bool) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if app.config.requireIfMatch {
+			app.preconditionRequiredResponse(w, r)
+			return false, false
+		}
+		return true, false
+	}
+
+	match := func(candidate string) bool { return versionMatches(candidate, movie) }
+	if !etagListMatchesFunc(header, match, false) {
+		app.preconditionFailedResponse(w, r)
+		return false, true
+	}
+	return true, true
+}
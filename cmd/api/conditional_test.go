@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http/httptest"
+	"openmovies/internal/data"
+	"testing"
+)
+
+func TestMovieETagVariants(t *testing.T) {
+	english := &data.Movie{ID: 7, Version: 3, TitleLocale: "en", TranslationLocale: "en"}
+	french := &data.Movie{ID: 7, Version: 3, TitleLocale: "fr", TranslationLocale: "fr"}
+	if movieETag(english) == movieETag(french) {
+		t.Fatalf("variants share the tag %s", movieETag(english))
+	}
+
+	r := httptest.NewRequest("GET", "/v1/movies/7", nil)
+	r.Header.Set("If-None-Match", movieETag(french))
+	if notModified(r, english) {
+		t.Errorf("If-None-Match %s matched the English variant", movieETag(french))
+	}
+	if !notModified(r, french) {
+		t.Errorf("If-None-Match %s did not match the French variant", movieETag(french))
+	}
+}
+
+func TestVersionMatches(t *testing.T) {
+	movie := &data.Movie{ID: 7, Version: 3, TitleLocale: "en"}
+	tests := []struct {
+		etag string
+		want bool
+	}{
+		{movieETag(movie), true},
+		{movieETag(&data.Movie{ID: 7, Version: 3, TitleLocale: "fr"}), true},
+		{`"7-3"`, true},
+		{`"7-4"`, false},
+		{`"7-30"`, false},
+		{`"7-30-0000beef"`, false},
+		{`"17-3"`, false},
+		{movieETag(&data.Movie{ID: 7, Version: 2}), false},
+	}
+	for _, tt := range tests {
+		if got := versionMatches(tt.etag, movie); got != tt.want {
+			t.Errorf("versionMatches(%s) = %t, want %t", tt.etag, got, tt.want)
+		}
+	}
+}
+
+func TestMovieETagRating(t *testing.T) {
+	before := &data.Movie{ID: 7, Version: 3, Rating: 7, RatingCount: 2}
+	after := &data.Movie{ID: 7, Version: 3, Rating: 7.5, RatingCount: 2}
+	if movieETag(before) == movieETag(after) {
+		t.Errorf("a new rating kept the tag %s", movieETag(before))
+	}
+	if !versionMatches(movieETag(before), after) {
+		t.Errorf("If-Match %s failed after a new rating", movieETag(before))
+	}
+}
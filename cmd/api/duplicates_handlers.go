@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"openmovies/internal/data"
+	"strconv"
+)
+
+func (app *application) getDuplicateCandidatesHandler(w http.ResponseWriter, r *http.Request) {
+	input := data.NewDuplicateFilters()
+	err := app.schemaDecoder.Decode(&input, r.URL.Query())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	candidates, metadata, err := app.models.Movies.GetDuplicateCandidates(input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"candidates": candidates, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) mergeMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Into int64 `json:"into" validate:"required,min=1"`
+	}
+	err = app.decodeJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	movie, err := app.models.Movies.Merge(id, input.Into, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrMergeIntoSelf):
+			app.fieldValidationResponse(w, r, []apiError{
+				{Field: "into", Message: "cannot merge a movie into itself"},
+			})
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
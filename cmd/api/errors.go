@@ -73,3 +73,35 @@ func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Requ
 	message := "your user account doesn't have the necessary permissions to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource has changed since you last fetched it"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (app *application) preconditionRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this request must be made conditional with an If-Match header"
+	app.errorResponse(w, r, http.StatusPreconditionRequired, message)
+}
+
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the request body content type is not supported for this resource"
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
+func (app *application) contentTooLargeResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the request body is larger than this resource accepts"
+	app.errorResponse(w, r, http.StatusRequestEntityTooLarge, message)
+}
+
+func (app *application) duplicateAliasResponse(w http.ResponseWriter, r *http.Request) {
+	app.fieldValidationResponse(w, r, []apiError{
+		{Field: "aliases", Message: "alias already names another genre"},
+	})
+}
+
+func (app *application) duplicateExternalIDResponse(w http.ResponseWriter, r *http.Request) {
+	app.fieldValidationResponse(w, r, []apiError{
+		{Field: "externalIds", Message: "external id is already mapped to another movie"},
+	})
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"openmovies/internal/data"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// eventBroker fans movie events announced by Postgres out to the open event
+// streams of this instance.
+type eventBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan *data.MovieEvent]struct{}
+	closed      bool
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{subscribers: map[chan *data.MovieEvent]struct{}{}}
+}
+
+// subscribe registers a stream. Its channel is closed when the stream falls
+// too far behind, when the listener lost events or when the server stops;
+// clients reconnect and resume from the log in the first two cases.
+func (b *eventBroker) subscribe() chan *data.MovieEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan *data.MovieEvent, 64)
+	if b.closed {
+		close(ch)
+		return ch
+	}
+	b.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (b *eventBroker) unsubscribe(ch chan *data.MovieEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (b *eventBroker) publish(event *data.MovieEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// reset drops every stream, and with stop refuses new ones too.
+func (b *eventBroker) reset(stop bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+	b.closed = b.closed || stop
+}
+
+// listenEvents feeds the broker from Postgres notifications until ctx is
+// cancelled, reconnecting with a growing delay when the connection drops.
+func (app *application) listenEvents(ctx context.Context) {
+	defer app.events.reset(true)
+
+	delay := time.Second
+	for {
+		connected := time.Now()
+		err := app.models.Events.Listen(ctx, func(eventId int64) {
+			events, err := app.models.Events.GetByIds([]int64{eventId})
+			if err != nil {
+				app.logger.LogError(err, map[string]string{"job": "listen_events"})
+				return
+			}
+			for _, event := range events {
+				app.events.publish(event)
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		app.logger.LogError(err, map[string]string{"job": "listen_events"})
+		// Notifications sent while disconnected are gone, so streams have to
+		// catch up from the log.
+		app.events.reset(false)
+
+		if time.Since(connected) > time.Minute {
+			delay = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, time.Minute)
+	}
+}
+
+// pruneEvents trims the event log to the configured retention.
+func (app *application) pruneEvents(ctx context.Context) (string, error) {
+	pruned, err := app.models.Events.Prune(app.config.events.retention)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("pruned %d events", pruned), nil
+}
+
+// writeEvent sends an event with an id of the form <event id>:<horizon>,
+// which is what a reconnecting client resumes from.
+func writeEvent(w http.ResponseWriter, event *data.MovieEvent) error {
+	_, err := fmt.Fprintf(w, "id: %d:%d\nevent: %s\ndata: %s\n\n", event.ID, event.Horizon, event.Type, event.Payload)
+	return err
+}
+
+// parseLastEventID reads a resume position written by writeEvent. A bare
+// event id, without horizon, is accepted too.
+func parseLastEventID(header string) (lastId int64, horizon int64, err error) {
+	id, rest, found := strings.Cut(header, ":")
+	lastId, err = strconv.ParseInt(id, 10, 64)
+	if err != nil || lastId < 0 {
+		return 0, 0, errors.New("Last-Event-ID must be an event id")
+	}
+	if found {
+		horizon, err = strconv.ParseInt(rest, 10, 64)
+		if err != nil || horizon < 0 {
+			return 0, 0, errors.New("Last-Event-ID must be an event id")
+		}
+	}
+	return lastId, horizon, nil
+}
+
+// movieEventsHandler streams movie changes as server-sent events. A client
+// sending Last-Event-ID first gets everything logged after that event, and
+// again any earlier event that was not committed yet when it got that one,
+// so it should skip event ids it has already seen. When the event has been
+// pruned meanwhile it gets a reset event instead and has to reload what it
+// holds.
+func (app *application) movieEventsHandler(w http.ResponseWriter, r *http.Request) {
+	var lastId, horizon int64
+	var err error
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		lastId, horizon, err = parseLastEventID(header)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	// Subscribe before reading the log so nothing committed in between is
+	// missed; events seen during the replay are skipped below.
+	events := app.events.subscribe()
+	defer app.events.unsubscribe(events)
+
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	_, err = fmt.Fprint(w, "retry: 3000\n\n")
+	if err != nil {
+		return
+	}
+
+	if lastId > 0 {
+		exists, err := app.models.Events.Exists(lastId)
+		if err != nil {
+			app.logger.LogError(err, nil)
+			return
+		}
+		if !exists {
+			_, err = fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+			if err != nil {
+				return
+			}
+			lastId = 0
+		}
+	}
+	// Live events repeating one of the replay are dropped. Ids are handed out
+	// before commit, so a live event can come with a lower id than the last
+	// one replayed and still be new.
+	replayed := map[int64]bool{}
+	for afterId := int64(0); lastId > 0 && horizon > 0; {
+		logged, err := app.models.Events.GetInFlight(afterId, lastId, horizon, 500)
+		if err != nil {
+			app.logger.LogError(err, nil)
+			return
+		}
+		for _, event := range logged {
+			if err = writeEvent(w, event); err != nil {
+				return
+			}
+			replayed[event.ID] = true
+			afterId = event.ID
+		}
+		if len(logged) < 500 {
+			break
+		}
+	}
+	for lastId > 0 {
+		logged, err := app.models.Events.GetAfter(lastId, 500)
+		if err != nil {
+			app.logger.LogError(err, nil)
+			return
+		}
+		for _, event := range logged {
+			if err = writeEvent(w, event); err != nil {
+				return
+			}
+			replayed[event.ID] = true
+			lastId = event.ID
+		}
+		if len(logged) < 500 {
+			break
+		}
+	}
+	if err = rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if replayed[event.ID] {
+				continue
+			}
+			if err = writeEvent(w, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err = fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err = rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http/httptest"
+	"openmovies/internal/data"
+	"strings"
+	"testing"
+)
+
+func TestWriteEventResumePosition(t *testing.T) {
+	event := &data.MovieEvent{
+		ID:      42,
+		Type:    data.EventMovieUpdated,
+		MovieID: 7,
+		Payload: json.RawMessage(`{"movie":{"id":7}}`),
+		Horizon: 1234,
+	}
+	rec := httptest.NewRecorder()
+	if err := writeEvent(rec, event); err != nil {
+		t.Fatal(err)
+	}
+
+	var id string
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		if value, found := strings.CutPrefix(scanner.Text(), "id: "); found {
+			id = value
+		}
+	}
+	if id == "" {
+		t.Fatalf("no id line in %q", rec.Body.String())
+	}
+
+	lastId, horizon, err := parseLastEventID(id)
+	if err != nil {
+		t.Fatalf("parseLastEventID(%q) error: %v", id, err)
+	}
+	if lastId != event.ID || horizon != event.Horizon {
+		t.Errorf("parseLastEventID(%q) = %d, %d, want %d, %d", id, lastId, horizon, event.ID, event.Horizon)
+	}
+}
+
+func TestParseLastEventID(t *testing.T) {
+	tests := []struct {
+		header  string
+		lastId  int64
+		horizon int64
+	}{
+		{"15", 15, 0},
+		{"15:900", 15, 900},
+		{"0:0", 0, 0},
+	}
+	for _, tt := range tests {
+		lastId, horizon, err := parseLastEventID(tt.header)
+		if err != nil {
+			t.Errorf("parseLastEventID(%q) error: %v", tt.header, err)
+			continue
+		}
+		if lastId != tt.lastId || horizon != tt.horizon {
+			t.Errorf("parseLastEventID(%q) = %d, %d, want %d, %d", tt.header, lastId, horizon, tt.lastId, tt.horizon)
+		}
+	}
+
+	for _, header := range []string{"", "x", "-1", "15:", "15:x", "15:-3", ":15"} {
+		if _, _, err := parseLastEventID(header); err == nil {
+			t.Errorf("parseLastEventID(%q) succeeded, want an error", header)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"openmovies/internal/data"
+	"openmovies/internal/export"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const exportBatchSize = 500
+
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	format := app.readString(qs, "format", export.FormatCSV)
+	qs.Del("format")
+
+	if !export.Supported(format) {
+		app.fieldValidationResponse(w, r, []apiError{
+			{Field: "format", Message: "format must be one of csv, jsonl"},
+		})
+		return
+	}
+
+	input := data.NewMovieFilters()
+	err := app.schemaDecoder.Decode(&input, qs)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	err = app.models.Genres.ResolveFilter(input.Genres)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var out io.Writer = w
+	useGzip := acceptsEncoding(r, "gzip")
+	if useGzip {
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		out = gz
+	}
+
+	writer, err := export.NewWriter(format, out)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// An export can easily outlive the server wide write timeout.
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="movies.%s"`, format))
+	w.Header().Add("Vary", "Accept-Encoding")
+	if useGzip {
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+	w.WriteHeader(http.StatusOK)
+
+	written := 0
+	err = app.models.Movies.Export(r.Context(), input, exportBatchSize, func(movie *data.Movie) error {
+		err := writer.Write(movie)
+		if err != nil {
+			return err
+		}
+		written++
+		if written%exportBatchSize == 0 {
+			if err = writer.Flush(); err != nil {
+				return err
+			}
+			if gz, ok := out.(*gzip.Writer); ok {
+				if err = gz.Flush(); err != nil {
+					return err
+				}
+			}
+			return rc.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		// The status line is already on the wire, so all we can do is log and
+		// cut the stream short.
+		app.logError(r, err)
+	}
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header of r allows
+// coding, either by name or through the * wildcard, with a non-zero q-value.
+func acceptsEncoding(r *http.Request, coding string) bool {
+	accepted := false
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(header, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name != coding && name != "*" {
+				continue
+			}
+			q := 1.0
+			for _, param := range strings.Split(params, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if ok && strings.EqualFold(strings.TrimSpace(key), "q") {
+					parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+					if err != nil {
+						parsed = 0
+					}
+					q = parsed
+				}
+			}
+			// An explicit entry for the coding overrides the wildcard.
+			if name == coding {
+				return q > 0
+			}
+			accepted = q > 0
+		}
+	}
+	return accepted
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"openmovies/internal/data"
+	"slices"
+)
+
+type GenreDto struct {
+	Slug    string   `json:"slug" validate:"max=100"`
+	Name    string   `json:"name" validate:"required,max=100"`
+	Aliases []string `json:"aliases" validate:"max=50,dive,required,max=100"`
+}
+
+// canonicalGenres maps the genre names supplied by a client onto taxonomy
+// slugs, dropping names that collapse into the same genre. It writes the
+// error response itself and returns nil when a name is unknown.
+func (app *application) canonicalGenres(w http.ResponseWriter, r *http.Request, genres []string) []string {
+	resolved, err := app.models.Genres.Resolve(genres)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil
+	}
+
+	var apiErr []apiError
+	slugs := make([]string, 0, len(genres))
+	for _, genre := range genres {
+		slug, ok := resolved[genre]
+		if !ok {
+			apiErr = append(apiErr, apiError{Field: "genres", Message: fmt.Sprintf("unknown genre %q", genre)})
+			continue
+		}
+		if !slices.Contains(slugs, slug) {
+			slugs = append(slugs, slug)
+		}
+	}
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return nil
+	}
+	return slugs
+}
+
+func (app *application) getGenresHandler(w http.ResponseWriter, r *http.Request) {
+	genres, err := app.models.Genres.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"genres": genres}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) postGenreHandler(w http.ResponseWriter, r *http.Request) {
+	var input GenreDto
+	err := app.decodeJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	genre := &data.Genre{
+		Slug:    input.Slug,
+		Name:    input.Name,
+		Aliases: input.Aliases,
+	}
+	if genre.Slug == "" {
+		genre.Slug = data.Slugify(genre.Name)
+	}
+	if genre.Slug == "" || data.Slugify(genre.Slug) != genre.Slug {
+		app.fieldValidationResponse(w, r, []apiError{
+			{Field: "slug", Message: "slug must be lower case letters and digits separated by single hyphens"},
+		})
+		return
+	}
+
+	err = app.models.Genres.Insert(genre)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateGenre):
+			app.fieldValidationResponse(w, r, []apiError{
+				{Field: "slug", Message: "duplicated slug"},
+			})
+		case errors.Is(err, data.ErrDuplicateAlias):
+			app.duplicateAliasResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/genres/%s", genre.Slug))
+
+	err = app.writeJson(w, http.StatusCreated, envelop{"genre": genre}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) putGenreHandler(w http.ResponseWriter, r *http.Request) {
+	genre, err := app.models.Genres.GetBySlug(mux.Vars(r)["slug"])
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input GenreDto
+	err = app.decodeJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+	if input.Slug != "" && input.Slug != genre.Slug {
+		app.fieldValidationResponse(w, r, []apiError{
+			{Field: "slug", Message: "slug cannot be changed, merge the genre instead"},
+		})
+		return
+	}
+
+	genre.Name = input.Name
+	genre.Aliases = input.Aliases
+	err = app.models.Genres.Update(genre)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateAlias):
+			app.duplicateAliasResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"genre": genre}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteGenreHandler(w http.ResponseWriter, r *http.Request) {
+	slug := mux.Vars(r)["slug"]
+	err := app.models.Genres.Delete(slug)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrGenreInUse):
+			app.errorResponse(w, r, http.StatusConflict, "genre is still used by movies, merge it into another genre instead")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"message": fmt.Sprintf("genre %s was deleted", slug)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) mergeGenreHandler(w http.ResponseWriter, r *http.Request) {
+	slug := mux.Vars(r)["slug"]
+
+	var input struct {
+		Into string `json:"into" validate:"required"`
+	}
+	err := app.decodeJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+	if input.Into == slug {
+		app.fieldValidationResponse(w, r, []apiError{
+			{Field: "into", Message: "cannot merge a genre into itself"},
+		})
+		return
+	}
+
+	err = app.models.Genres.Merge(slug, input.Into, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	genre, err := app.models.Genres.GetBySlug(input.Into)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"genre": genre}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
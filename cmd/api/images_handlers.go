@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"image"
+	"io"
+	"mime"
+	"net/http"
+	"openmovies/internal/data"
+	"openmovies/internal/imaging"
+	"openmovies/internal/storage"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var imageContentTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+var imageFileRX = regexp.MustCompile(`^(original|small|medium|large)\.(jpg|png|gif)$`)
+
+// imageVariantNames lists the files stored for every image.
+func imageVariantNames() []string {
+	names := []string{data.ImageOriginal}
+	for _, variant := range imaging.Variants {
+		names = append(names, variant.Name)
+	}
+	return names
+}
+
+func (app *application) setImageURLs(images ...*data.MovieImage) {
+	base := strings.TrimSuffix(app.config.images.baseURL, "/")
+	for _, image := range images {
+		image.URLs = map[string]string{}
+		for _, name := range imageVariantNames() {
+			image.URLs[name] = base + "/" + image.Key(name)
+		}
+	}
+}
+
+// attachImages loads the images of movies and fills in their URLs.
+func (app *application) attachImages(movies ...*data.Movie) error {
+	ids := make([]int64, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+	images, err := app.models.Images.GetForMovies(ids)
+	if err != nil {
+		return err
+	}
+	for _, movie := range movies {
+		movie.Images = images[movie.ID]
+		app.setImageURLs(movie.Images...)
+	}
+	return nil
+}
+
+// readImageUpload pulls the image file and its kind out of a multipart body
+// without buffering anything but the image itself.
+func readImageUpload(r *http.Request, maxSize int64) (file []byte, kind string, err error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", err
+	}
+	kind = data.ImageKindPoster
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		switch part.FormName() {
+		case "kind":
+			value, err := io.ReadAll(io.LimitReader(part, 64))
+			if err != nil {
+				return nil, "", err
+			}
+			kind = string(value)
+		case "image":
+			file, err = io.ReadAll(io.LimitReader(part, maxSize+1))
+			if err != nil {
+				return nil, "", err
+			}
+		}
+		part.Close()
+	}
+	return file, kind, nil
+}
+
+func (app *application) postMovieImageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Leave some room on top of the file for the multipart framing and the
+	// other form fields.
+	r.Body = http.MaxBytesReader(w, r.Body, app.config.images.maxSize+64<<10)
+	file, kind, err := readImageUpload(r, app.config.images.maxSize)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.contentTooLargeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+	if int64(len(file)) > app.config.images.maxSize {
+		app.contentTooLargeResponse(w, r)
+		return
+	}
+
+	var apiErr []apiError
+	if len(file) == 0 {
+		apiErr = append(apiErr, apiError{Field: "image", Message: "must be provided"})
+	}
+	if !slices.Contains([]string{data.ImageKindPoster, data.ImageKindBackdrop, data.ImageKindStill}, kind) {
+		apiErr = append(apiErr, apiError{Field: "kind", Message: "must be one of poster backdrop still"})
+	}
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	// Trust the bytes rather than the client supplied part headers.
+	contentType := http.DetectContentType(file)
+	if !slices.Contains(imageContentTypes, contentType) {
+		app.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+	img, _, err := imaging.Decode(file)
+	if err != nil {
+		app.fieldValidationResponse(w, r, []apiError{
+			{Field: "image", Message: fmt.Sprintf("must be a readable image no larger than %d megapixels", imaging.MaxPixels/1_000_000)},
+		})
+		return
+	}
+
+	image := &data.MovieImage{
+		MovieID:     id,
+		Kind:        kind,
+		ContentType: contentType,
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+		Size:        int64(len(file)),
+	}
+	err = app.models.Images.Insert(image)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.storeImage(r.Context(), image, file, img)
+	if err != nil {
+		app.removeImage(image)
+		_, _ = app.models.Images.Delete(image.MovieID, image.ID)
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.setImageURLs(image)
+	headers := make(http.Header)
+	headers.Set("Location", image.URLs[data.ImageOriginal])
+	err = app.writeJson(w, http.StatusCreated, envelop{"image": image}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// storeImage writes the original upload and every resized variant. The
+// variants are rendered largest first, each from the one before, so the
+// full size image is only read once.
+func (app *application) storeImage(ctx context.Context, image *data.MovieImage, file []byte, img image.Image) error {
+	err := app.storage.Put(ctx, image.Key(data.ImageOriginal), bytes.NewReader(file), int64(len(file)), image.ContentType)
+	if err != nil {
+		return err
+	}
+	variants := slices.Clone(imaging.Variants)
+	slices.SortFunc(variants, func(a, b imaging.Variant) int { return b.Width - a.Width })
+	img = imaging.ToRGBA(img)
+	for _, variant := range variants {
+		img = imaging.Resize(img, variant.Width)
+		var buf bytes.Buffer
+		err = imaging.EncodeJPEG(&buf, img)
+		if err != nil {
+			return err
+		}
+		err = app.storage.Put(ctx, image.Key(variant.Name), &buf, int64(buf.Len()), "image/jpeg")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeImage deletes every stored file of an image, logging rather than
+// failing on errors since the record is already gone or about to be.
+func (app *application) removeImage(image *data.MovieImage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var firstErr error
+	for _, name := range imageVariantNames() {
+		err := app.storage.Delete(ctx, image.Key(name))
+		if err != nil {
+			app.logger.LogError(err, map[string]string{"key": image.Key(name)})
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func (app *application) deleteMovieImageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	imageId, err := strconv.ParseInt(mux.Vars(r)["imageId"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	image, err := app.models.Images.Delete(id, imageId)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	keys := []string{}
+	for _, name := range imageVariantNames() {
+		keys = append(keys, image.Key(name))
+	}
+	err = app.enqueue(removeImageFilesJob{Keys: keys})
+	if err != nil {
+		app.logger.LogError(err, nil)
+		app.removeImage(image)
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"message": "image successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// serveImageHandler streams a stored image file of a live movie. Keys embed
+// the image id and images are never rewritten, so responses may be cached
+// indefinitely, though only by the client since reading them takes a
+// permission.
+func (app *application) serveImageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	file := mux.Vars(r)["file"]
+	if !imageFileRX.MatchString(file) {
+		app.notFoundResponse(w, r)
+		return
+	}
+	_, err = app.models.Images.GetById(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	key := fmt.Sprintf("images/%d/%s", id, file)
+
+	etag := fmt.Sprintf(`"%s"`, key)
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Header().Set("ETag", etag)
+	if etagListMatches(r.Header.Get("If-None-Match"), etag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	object, err := app.storage.Get(r.Context(), key)
+	if err != nil {
+		w.Header().Del("Cache-Control")
+		w.Header().Del("ETag")
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer object.Body.Close()
+
+	contentType := object.ContentType
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = mime.TypeByExtension(path.Ext(file))
+	}
+	w.Header().Set("Content-Type", contentType)
+	if object.ContentLength >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(object.ContentLength, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, err = io.Copy(w, object.Body)
+	if err != nil {
+		app.logger.LogError(err, map[string]string{"key": key})
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"openmovies/internal/backoff"
+	"openmovies/internal/data"
+	"openmovies/internal/mailer"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// jobArgs is implemented by the payload of every kind of job.
+type jobArgs interface {
+	jobKind() string
+}
+
+type jobHandler func(ctx context.Context, payload json.RawMessage) error
+
+// handleJob adapts a handler taking typed arguments to the queue.
+func handleJob[T jobArgs](fn func(ctx context.Context, args T) error) jobHandler {
+	return func(ctx context.Context, payload json.RawMessage) error {
+		var args T
+		if err := json.Unmarshal(payload, &args); err != nil {
+			return fmt.Errorf("decoding %s job: %w", args.jobKind(), err)
+		}
+		return fn(ctx, args)
+	}
+}
+
+func (app *application) jobHandlers() map[string]jobHandler {
+	return map[string]jobHandler{
+		welcomeEmailJob{}.jobKind():     handleJob(app.sendWelcomeEmail),
+		removeImageFilesJob{}.jobKind(): handleJob(app.removeImageFiles),
+	}
+}
+
+// enqueue persists a job to run as soon as a worker is free.
+func (app *application) enqueue(args jobArgs) error {
+	return app.enqueueAt(args, time.Time{})
+}
+
+// enqueueAt persists a job to run at runAt.
+func (app *application) enqueueAt(args jobArgs, runAt time.Time) error {
+	job, err := app.newJob(args, runAt)
+	if err != nil {
+		return err
+	}
+	return app.models.Jobs.Insert(job)
+}
+
+// newJob builds the queue entry for args, for models that queue it as part
+// of a larger transaction.
+func (app *application) newJob(args jobArgs, runAt time.Time) (*data.Job, error) {
+	payload, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	return &data.Job{
+		Kind:        args.jobKind(),
+		Payload:     payload,
+		MaxAttempts: int32(app.config.jobs.maxAttempts),
+		RunAt:       runAt,
+	}, nil
+}
+
+// runJobs claims due jobs and runs up to the configured number at once until
+// ctx is cancelled. Running jobs then get the drain timeout to finish before
+// their context is cancelled and they are handed back to the queue.
+func (app *application) runJobs(ctx context.Context) {
+	cfg := app.config.jobs
+	handlers := app.jobHandlers()
+	ticker := time.NewTicker(cfg.pollInterval)
+	defer ticker.Stop()
+
+	runCtx, cancelRuns := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelRuns()
+	var running sync.WaitGroup
+	slots := make(chan struct{}, cfg.concurrency)
+
+	defer func() {
+		drained := make(chan struct{})
+		go func() {
+			running.Wait()
+			close(drained)
+		}()
+		select {
+		case <-drained:
+		case <-time.After(cfg.drainTimeout):
+			cancelRuns()
+			<-drained
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		free := cfg.concurrency - len(slots)
+		if free == 0 {
+			continue
+		}
+		jobs, err := app.models.Jobs.Claim(free, 2*cfg.timeout)
+		if err != nil {
+			app.logger.LogError(err, map[string]string{"job": "run_jobs"})
+			continue
+		}
+		for _, job := range jobs {
+			slots <- struct{}{}
+			running.Add(1)
+			go func(job *data.Job) {
+				defer running.Done()
+				defer func() { <-slots }()
+				app.runJob(runCtx, handlers, job)
+			}(job)
+		}
+	}
+}
+
+func (app *application) runJob(ctx context.Context, handlers map[string]jobHandler, job *data.Job) {
+	cfg := app.config.jobs
+	properties := map[string]string{"job": job.Kind, "id": strconv.FormatInt(job.ID, 10)}
+
+	err := func() (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = fmt.Errorf("panic: %v", p)
+			}
+		}()
+		handler, ok := handlers[job.Kind]
+		if !ok {
+			return errors.New("no handler for job kind " + job.Kind)
+		}
+		jobCtx, cancel := context.WithTimeout(ctx, cfg.timeout)
+		defer cancel()
+		return handler(jobCtx, job.Payload)
+	}()
+
+	if err != nil && ctx.Err() != nil {
+		// Cut short by shutdown rather than failed.
+		if err = app.models.Jobs.Release(job.ID, job.LeaseToken); err != nil {
+			app.logger.LogError(err, properties)
+		}
+		return
+	}
+	if err != nil {
+		app.logger.LogError(err, properties)
+	}
+	retry := backoff.Exponential(int(job.Attempts)+1, cfg.backoffBase, cfg.backoffMax)
+	if err = app.models.Jobs.Complete(job.ID, job.LeaseToken, err, retry); err != nil {
+		app.logger.LogError(err, properties)
+	}
+}
+
+type welcomeEmailJob struct {
+	UserID int64 `json:"userId"`
+}
+
+func (welcomeEmailJob) jobKind() string { return "welcome_email" }
+
+// sendWelcomeEmail mails a new user an activation token. The token is issued
+// here rather than at sign up so that its plaintext stays out of the job
+// payload.
+func (app *application) sendWelcomeEmail(ctx context.Context, args welcomeEmailJob) error {
+	user, err := app.models.Users.GetById(args.UserID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.Activated {
+		return nil
+	}
+
+	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+	if err != nil {
+		return err
+	}
+	return app.mailer.Send(user.Email, user.Locale, mailer.UserWelcome, mailer.UserWelcomeData{
+		Name:            user.Name,
+		UserID:          user.ID,
+		ActivationToken: token.Plaintext,
+	})
+}
+
+type removeImageFilesJob struct {
+	Keys []string `json:"keys"`
+}
+
+func (removeImageFilesJob) jobKind() string { return "remove_image_files" }
+
+// removeImageFiles deletes the stored files of an image whose record is gone.
+func (app *application) removeImageFiles(ctx context.Context, args removeImageFilesJob) error {
+	for _, key := range args.Keys {
+		if err := app.storage.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
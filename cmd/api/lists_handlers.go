@@ -0,0 +1,335 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"openmovies/internal/data"
+	"strconv"
+)
+
+func (app *application) getListsHandler(w http.ResponseWriter, r *http.Request) {
+	input := data.NewListFilters()
+	err := app.schemaDecoder.Decode(&input, r.URL.Query())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	lists, metadata, err := app.models.Lists.GetAllForUser(app.contextGetUser(r).ID, input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"lists": lists, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) postListHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string `json:"name" validate:"required,max=200"`
+		Description string `json:"description" validate:"max=2000"`
+		Visibility  string `json:"visibility" validate:"omitempty,oneof=private unlisted public"`
+	}
+	err := app.decodeJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	list := &data.MovieList{
+		UserID:      app.contextGetUser(r).ID,
+		Name:        input.Name,
+		Description: input.Description,
+		Visibility:  input.Visibility,
+	}
+	if list.Visibility == "" {
+		list.Visibility = data.ListVisibilityPrivate
+	}
+	err = app.models.Lists.Insert(list)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/lists/%d", list.ID))
+
+	err = app.writeJson(w, http.StatusCreated, envelop{"list": list}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getListForRequest loads the list named in the URL. With owner set only the
+// owner gets it back, otherwise anyone allowed to view it does. It writes the
+// error response itself when it returns nil.
+func (app *application) getListForRequest(w http.ResponseWriter, r *http.Request, owner bool) *data.MovieList {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	list, err := app.models.Lists.GetById(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	user := app.contextGetUser(r)
+	if !list.CanView(user) {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+	if owner && list.UserID != user.ID {
+		app.notPermittedResponse(w, r)
+		return nil
+	}
+	if list.UserID != user.ID {
+		list.ShareToken = ""
+	}
+	return list
+}
+
+func (app *application) getListHandler(w http.ResponseWriter, r *http.Request) {
+	list := app.getListForRequest(w, r, false)
+	if list == nil {
+		return
+	}
+
+	err := app.writeJson(w, http.StatusOK, envelop{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getSharedListHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := app.models.Lists.GetByShareToken(mux.Vars(r)["token"])
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	list.ShareToken = ""
+
+	err = app.writeJson(w, http.StatusOK, envelop{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) patchListHandler(w http.ResponseWriter, r *http.Request) {
+	list := app.getListForRequest(w, r, true)
+	if list == nil {
+		return
+	}
+
+	var input struct {
+		Name        *string `json:"name" validate:"omitnil,min=1,max=200"`
+		Description *string `json:"description" validate:"omitnil,max=2000"`
+		Visibility  *string `json:"visibility" validate:"omitnil,oneof=private unlisted public"`
+	}
+	err := app.decodeJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	if input.Name != nil {
+		list.Name = *input.Name
+	}
+	if input.Description != nil {
+		list.Description = *input.Description
+	}
+	if input.Visibility != nil {
+		list.Visibility = *input.Visibility
+	}
+
+	err = app.models.Lists.Update(list)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteListHandler(w http.ResponseWriter, r *http.Request) {
+	list := app.getListForRequest(w, r, true)
+	if list == nil {
+		return
+	}
+
+	err := app.models.Lists.Delete(list.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"message": fmt.Sprintf("list with id: %d was deleted", list.ID)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) postListItemHandler(w http.ResponseWriter, r *http.Request) {
+	list := app.getListForRequest(w, r, true)
+	if list == nil {
+		return
+	}
+
+	var input struct {
+		MovieID  int64  `json:"movieId" validate:"required,min=1"`
+		Position int32  `json:"position" validate:"min=0"`
+		Note     string `json:"note" validate:"max=1000"`
+	}
+	err := app.decodeJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	item := &data.ListItem{
+		MovieID:  input.MovieID,
+		Position: input.Position,
+		Note:     input.Note,
+	}
+	err = app.models.Lists.AddItem(list.ID, item)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.fieldValidationResponse(w, r, []apiError{
+				{Field: "movieId", Message: "movie does not exist"},
+			})
+		case errors.Is(err, data.ErrDuplicateListItem):
+			app.fieldValidationResponse(w, r, []apiError{
+				{Field: "movieId", Message: "movie is already in the list"},
+			})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusCreated, envelop{"item": item}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteListItemHandler(w http.ResponseWriter, r *http.Request) {
+	list := app.getListForRequest(w, r, true)
+	if list == nil {
+		return
+	}
+	movieId, err := strconv.ParseInt(mux.Vars(r)["movieId"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Lists.RemoveItem(list.ID, movieId)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) putListOrderHandler(w http.ResponseWriter, r *http.Request) {
+	list := app.getListForRequest(w, r, true)
+	if list == nil {
+		return
+	}
+
+	var input struct {
+		MovieIDs []int64 `json:"movieIds" validate:"required,unique"`
+	}
+	err := app.decodeJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	err = app.models.Lists.Reorder(list.ID, input.MovieIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidListOrder):
+			app.fieldValidationResponse(w, r, []apiError{
+				{Field: "movieIds", Message: "must list every movie in the list exactly once"},
+			})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	list, err = app.models.Lists.GetById(list.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
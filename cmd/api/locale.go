@@ -0,0 +1,73 @@
+package main
+
+import (
+	"golang.org/x/text/language"
+	"net/http"
+	"openmovies/internal/data"
+	"slices"
+)
+
+// requestLocales lists the locales a response may be localised into, most
+// preferred first. The lang query parameter wins over Accept-Language, and
+// every region or script specific tag falls back to its bare language.
+func (app *application) requestLocales(r *http.Request) ([]string, error) {
+	var tags []language.Tag
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		tag, err := language.Parse(lang)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	// A malformed Accept-Language header is not worth failing the request
+	// for, the response simply stays in the original language.
+	accepted, _, err := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if err == nil {
+		tags = append(tags, accepted...)
+	}
+
+	// The * wildcard of Accept-Language parses as mul, which like und names
+	// no language a title could be written in.
+	wildcard := language.Make("mul")
+	locales := []string{}
+	for _, tag := range tags {
+		if tag == language.Und || tag == wildcard {
+			continue
+		}
+		candidates := []string{tag.String()}
+		if base, confidence := tag.Base(); confidence != language.No {
+			candidates = append(candidates, base.String())
+		}
+		for _, locale := range candidates {
+			if !slices.Contains(locales, locale) {
+				locales = append(locales, locale)
+			}
+		}
+	}
+	return locales, nil
+}
+
+// localizeMovies swaps in the titles and translations matching the request's
+// language. It writes the error response itself and reports whether the
+// caller may go on.
+func (app *application) localizeMovies(w http.ResponseWriter, r *http.Request, headers http.Header, movies ...*data.Movie) bool {
+	locales, err := app.requestLocales(r)
+	if err != nil {
+		app.fieldValidationResponse(w, r, []apiError{
+			{Field: "lang", Message: "must be a valid BCP-47 language tag"},
+		})
+		return false
+	}
+	err = app.models.Titles.Localize(movies, locales)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+	err = app.models.Translations.Localize(movies, locales)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+	headers.Add("Vary", "Accept-Language")
+	return true
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"openmovies/internal/data"
+	"openmovies/internal/mailer"
+	"strconv"
+)
+
+// getCapturedMailHandler lists the messages delivered to the memory mail
+// transport. It is only routed in development.
+func (app *application) getCapturedMailHandler(w http.ResponseWriter, r *http.Request) {
+	capture, ok := app.mailTransport.(*mailer.Memory)
+	if !ok {
+		app.errorResponse(w, r, http.StatusNotFound, "mail is only captured with the memory mail transport")
+		return
+	}
+
+	err := app.writeJson(w, http.StatusOK, envelop{"messages": capture.Messages()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteCapturedMailHandler(w http.ResponseWriter, r *http.Request) {
+	capture, ok := app.mailTransport.(*mailer.Memory)
+	if !ok {
+		app.errorResponse(w, r, http.StatusNotFound, "mail is only captured with the memory mail transport")
+		return
+	}
+	capture.Reset()
+
+	err := app.writeJson(w, http.StatusOK, envelop{"message": "captured mail cleared"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getMailTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJson(w, http.StatusOK, envelop{"templates": app.mailTemplates.List()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// previewMailTemplateHandler renders a template with its sample data. The
+// html and text formats return the bare body for viewing in a browser.
+func (app *application) previewMailTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if !app.mailTemplates.Has(name) {
+		app.notFoundResponse(w, r)
+		return
+	}
+	input := struct {
+		Locale string `schema:"locale" validate:"omitempty,bcp47_language_tag"`
+		Format string `schema:"format" validate:"oneof=json html text"`
+	}{Format: "json"}
+	err := app.schemaDecoder.Decode(&input, r.URL.Query())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	msg, err := app.mailTemplates.Preview(name, input.Locale)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	switch input.Format {
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(msg.HTMLBody))
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(msg.PlainBody))
+	default:
+		err = app.writeJson(w, http.StatusOK, envelop{"message": msg}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+func (app *application) getMailMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	input := data.NewMailFilters()
+	err := app.schemaDecoder.Decode(&input, r.URL.Query())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	messages, metadata, err := app.models.Mail.GetAll(input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"messages": messages, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getMailMessageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	msg, err := app.models.Mail.GetById(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"message": msg}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) resendMailMessageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	msg, err := app.models.Mail.Resend(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrSuppressed):
+			app.errorResponse(w, r, http.StatusConflict, "the recipient is on the suppression list, remove it from there first")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusAccepted, envelop{"message": msg}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getMailSuppressionsHandler(w http.ResponseWriter, r *http.Request) {
+	input := data.NewSuppressionFilters()
+	err := app.schemaDecoder.Decode(&input, r.URL.Query())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	suppressions, metadata, err := app.models.Mail.GetSuppressions(input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"suppressions": suppressions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) postMailSuppressionHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email  string `json:"email" validate:"required,email"`
+		Reason string `json:"reason" validate:"required,oneof=bounce unsubscribe complaint manual"`
+		Detail string `json:"detail" validate:"max=1000"`
+	}
+	err := app.decodeJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	suppression := &data.MailSuppression{
+		Email:  input.Email,
+		Reason: input.Reason,
+		Detail: input.Detail,
+	}
+	err = app.models.Mail.Suppress(suppression)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusCreated, envelop{"suppression": suppression}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteMailSuppressionHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.models.Mail.Unsuppress(mux.Vars(r)["email"])
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"message": "suppression successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// unsubscribeMailHandler suppresses the address a signed unsubscribe link was
+// sent to. Transactional mail such as account activation still reaches it. It serves the one-click POST mail clients make for the
+// List-Unsubscribe header, so it needs no authentication.
+func (app *application) unsubscribeMailHandler(w http.ResponseWriter, r *http.Request) {
+	secret := app.config.mailer.unsubscribeSecret
+	email, ok := mailer.VerifyUnsubscribeToken(secret, r.URL.Query().Get("token"))
+	if secret == "" || !ok {
+		app.fieldValidationResponse(w, r, []apiError{{Field: "token", Message: "invalid unsubscribe token"}})
+		return
+	}
+
+	err := app.models.Mail.Suppress(&data.MailSuppression{
+		Email:  email,
+		Reason: data.SuppressionUnsubscribe,
+		Detail: "unsubscribe link",
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"message": "you will no longer receive mail at this address"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/time/rate"
+	"net/url"
+	"openmovies/internal/backoff"
+	"openmovies/internal/data"
+	"openmovies/internal/mailer"
+	"strconv"
+	"time"
+)
+
+// queuedMailer renders mail and stores it in the outgoing queue, from which
+// deliverMail sends it.
+type queuedMailer struct {
+	templates *mailer.Templates
+	queue     data.MailRepository
+	sender    string
+}
+
+func (m queuedMailer) Send(recipient string, locale string, templateName string, templateData any) error {
+	msg, err := m.templates.Render(m.sender, recipient, locale, templateName, templateData)
+	if err != nil {
+		return err
+	}
+	return m.queue.Insert(&data.MailMessage{
+		Sender:        msg.From,
+		Recipient:     msg.To,
+		Template:      msg.Template,
+		Locale:        msg.Locale,
+		Subject:       msg.Subject,
+		Transactional: msg.Transactional,
+		PlainBody:     msg.PlainBody,
+		HTMLBody:      msg.HTMLBody,
+	})
+}
+
+// deliverMail sends due mail through the configured transport until ctx is
+// cancelled. Each recipient domain gets its own send rate, and mail over it
+// waits for a later round without using up an attempt. The limits hold per
+// process, so replicas together may send more.
+func (app *application) deliverMail(ctx context.Context) {
+	cfg := app.config.mailQueue
+	ticker := time.NewTicker(cfg.pollInterval)
+	defer ticker.Stop()
+
+	limiters := map[string]*rate.Limiter{}
+	limiter := func(domain string) *rate.Limiter {
+		l, ok := limiters[domain]
+		if !ok {
+			l = rate.NewLimiter(rate.Limit(cfg.domainRate/60), cfg.domainBurst)
+			limiters[domain] = l
+		}
+		return l
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Messages are claimed one at a time, so the lease only has to cover
+		// a single send and nothing claimed waits behind a slow server.
+		for ctx.Err() == nil {
+			due, err := app.models.Mail.ClaimDue(1, time.Minute)
+			if err != nil {
+				app.logger.LogError(err, map[string]string{"job": "deliver_mail"})
+				break
+			}
+			if len(due) == 0 {
+				break
+			}
+			app.sendMail(due[0], limiter(mailer.Domain(due[0].Recipient)))
+		}
+	}
+}
+
+// sendMail makes one attempt at a claimed message and records its outcome
+// under the claim.
+func (app *application) sendMail(msg *data.MailMessage, limiter *rate.Limiter) {
+	cfg := app.config.mailQueue
+	properties := map[string]string{"job": "deliver_mail", "id": strconv.FormatInt(msg.ID, 10)}
+
+	reservation := limiter.Reserve()
+	if delay := reservation.Delay(); delay > 0 {
+		reservation.Cancel()
+		err := app.models.Mail.Postpone(msg.ID, msg.LeaseToken, max(delay, time.Second))
+		if err != nil {
+			app.logger.LogError(err, properties)
+		}
+		return
+	}
+
+	sendErr := app.mailTransport.Deliver(&mailer.Message{
+		From:           msg.Sender,
+		To:             msg.Recipient,
+		Subject:        msg.Subject,
+		PlainBody:      msg.PlainBody,
+		HTMLBody:       msg.HTMLBody,
+		Template:       msg.Template,
+		Locale:         msg.Locale,
+		CreatedAt:      msg.CreatedAt,
+		Transactional:  msg.Transactional,
+		UnsubscribeURL: app.unsubscribeURL(msg),
+	})
+	permanent, bounced := mailer.Classify(sendErr)
+	if sendErr != nil {
+		app.logger.LogError(sendErr, properties)
+	}
+	retry := backoff.Exponential(int(msg.Attempts)+1, cfg.backoffBase, cfg.backoffMax)
+	err := app.models.Mail.Complete(msg.ID, msg.LeaseToken, sendErr == nil, sendErr, permanent, retry, cfg.maxAttempts)
+	if err != nil {
+		app.logger.LogError(err, properties)
+	}
+	if bounced {
+		err = app.models.Mail.Suppress(&data.MailSuppression{
+			Email:  msg.Recipient,
+			Reason: data.SuppressionBounce,
+			Detail: sendErr.Error(),
+		})
+		if err != nil {
+			app.logger.LogError(err, properties)
+		}
+	}
+}
+
+// unsubscribeURL returns the signed link that suppresses further mail to the
+// recipient of msg, or "" when msg is transactional, which an unsubscribe
+// would not stop, or no unsubscribe secret is configured.
+func (app *application) unsubscribeURL(msg *data.MailMessage) string {
+	secret := app.config.mailer.unsubscribeSecret
+	if secret == "" || msg.Transactional {
+		return ""
+	}
+	return app.config.mailer.unsubscribeURL + "?token=" + url.QueryEscape(mailer.UnsubscribeToken(secret, msg.Recipient))
+}
+
+// pruneMail deletes finished mail older than the configured retention.
+func (app *application) pruneMail(ctx context.Context) (string, error) {
+	pruned, err := app.models.Mail.Prune(app.config.mailQueue.retention)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("pruned %d messages", pruned), nil
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
+	"fmt"
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/schema"
 	_ "github.com/jackc/pgx/v5/stdlib"
@@ -11,6 +13,7 @@ import (
 	"openmovies/internal/data"
 	"openmovies/internal/jsonlog"
 	"openmovies/internal/mailer"
+	"openmovies/internal/storage"
 	"os"
 	"sync"
 	"time"
@@ -24,14 +27,92 @@ type config struct {
 	db   struct {
 		dsn string
 	}
+	mailer struct {
+		backend string
+		dir     string
+		sender  string
+		// Mail carries an unsubscribe link only when unsubscribeSecret is set.
+		unsubscribeSecret string
+		unsubscribeURL    string
+	}
+	mailQueue struct {
+		pollInterval time.Duration
+		maxAttempts  int
+		backoffBase  time.Duration
+		backoffMax   time.Duration
+		domainRate   float64
+		domainBurst  int
+		retention    time.Duration
+	}
 	smtp struct {
 		host     string
 		port     int
 		username string
 		password string
-		sender   string
 	}
-	jwtSecret string
+	jwtSecret      string
+	requireIfMatch bool
+	trash          struct {
+		retention     time.Duration
+		purgeInterval time.Duration
+	}
+	storage struct {
+		backend string
+		dir     string
+		s3      struct {
+			endpoint  string
+			region    string
+			bucket    string
+			accessKey string
+			secretKey string
+		}
+	}
+	images struct {
+		maxSize int64
+		baseURL string
+	}
+	similar struct {
+		weights data.SimilarityWeights
+	}
+	matviews struct {
+		refreshInterval time.Duration
+	}
+	tokens struct {
+		purgeSchedule string
+	}
+	users struct {
+		unactivatedDays int
+		purgeSchedule   string
+	}
+	recommendations struct {
+		neighbours      int
+		minCoRatings    int
+		refreshInterval time.Duration
+	}
+	stats struct {
+		buffer        int
+		flushInterval time.Duration
+	}
+	webhooks struct {
+		pollInterval time.Duration
+		timeout      time.Duration
+		maxAttempts  int
+		backoffBase  time.Duration
+		backoffMax   time.Duration
+		allowPrivate bool
+	}
+	events struct {
+		retention time.Duration
+	}
+	jobs struct {
+		concurrency  int
+		pollInterval time.Duration
+		timeout      time.Duration
+		maxAttempts  int
+		backoffBase  time.Duration
+		backoffMax   time.Duration
+		drainTimeout time.Duration
+	}
 }
 
 type application struct {
@@ -41,6 +122,11 @@ type application struct {
 	schemaDecoder *schema.Decoder
 	models        data.Models
 	mailer        mailer.Mailer
+	mailTemplates *mailer.Templates
+	mailTransport mailer.Transport
+	storage       storage.Storage
+	statEvents    chan statEvent
+	events        *eventBroker
 	wg            sync.WaitGroup
 }
 
@@ -51,28 +137,111 @@ func main() {
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
 	flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("OPENMOVIES_DB_DSN"), "POSTGRES DSN")
 
-	flag.StringVar(&cfg.smtp.host, "smtp-host", "sandbox.smtp.mailtrap.io", "Smtp host")
+	flag.StringVar(&cfg.mailer.backend, "mailer", "", "Mail transport (smtp|file|log|memory), smtp unless -env=development")
+	flag.StringVar(&cfg.mailer.dir, "mailer-dir", "./mail", "Directory the file mail transport writes .eml files to")
+	flag.StringVar(&cfg.mailer.sender, "mailer-sender", "OpenMovies <no-reply@openmovies.local>", "Sender of outgoing mail")
+	flag.StringVar(&cfg.mailer.unsubscribeSecret, "mail-unsubscribe-secret", os.Getenv("OPENMOVIES_MAIL_UNSUBSCRIBE_SECRET"), "Secret signing unsubscribe links, none are sent without it")
+	flag.StringVar(&cfg.mailer.unsubscribeURL, "mail-unsubscribe-url", "http://localhost:4000/v1/mail/unsubscribe", "Public URL of the unsubscribe endpoint")
+	flag.DurationVar(&cfg.mailQueue.pollInterval, "mail-poll-interval", 2*time.Second, "How often queued mail is picked up")
+	flag.IntVar(&cfg.mailQueue.maxAttempts, "mail-max-attempts", 8, "Attempts before a mail message is marked dead")
+	flag.DurationVar(&cfg.mailQueue.backoffBase, "mail-backoff-base", time.Minute, "Wait after the first failed mail attempt, doubled for each further failure")
+	flag.DurationVar(&cfg.mailQueue.backoffMax, "mail-backoff-max", 6*time.Hour, "Longest wait between mail attempts")
+	flag.Float64Var(&cfg.mailQueue.domainRate, "mail-domain-rate", 60, "Mail sent per minute to each recipient domain")
+	flag.IntVar(&cfg.mailQueue.domainBurst, "mail-domain-burst", 10, "Mail sent to a recipient domain at once before its rate applies")
+	flag.DurationVar(&cfg.mailQueue.retention, "mail-retention", 30*24*time.Hour, "How long sent, dead and suppressed mail is kept")
+	flag.StringVar(&cfg.smtp.host, "smtp-host", "localhost", "Smtp host")
 	flag.IntVar(&cfg.smtp.port, "smtp-port", 25, "Smtp port")
-	flag.StringVar(&cfg.smtp.username, "smtp-username", "10f7d074fb1524", "Smtp username")
-	flag.StringVar(&cfg.smtp.password, "smtp-password", "43703899194531", "Smtp password")
-	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "nguyentanphu@flirtingapp.com", "Smtp sender")
+	flag.StringVar(&cfg.smtp.username, "smtp-username", os.Getenv("OPENMOVIES_SMTP_USERNAME"), "Smtp username")
+	flag.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("OPENMOVIES_SMTP_PASSWORD"), "Smtp password")
 	flag.StringVar(&cfg.jwtSecret, "jwt-secret", "7*}\"[k{.eH#P]>u()o(0]xjgXq^2ofP}y!zP$X;nz6Hz#3O?Z$|ilb)i<8Nymhd", "JWT secret")
+	flag.BoolVar(&cfg.requireIfMatch, "require-if-match", false, "Reject movie writes that carry no If-Match header")
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted movies stay restorable")
+	flag.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "How often expired trash is purged")
+	flag.StringVar(&cfg.storage.backend, "storage", "local", "Image storage backend (local|s3)")
+	flag.StringVar(&cfg.storage.dir, "storage-dir", "./uploads", "Directory for the local storage backend")
+	flag.StringVar(&cfg.storage.s3.endpoint, "s3-endpoint", "http://localhost:9000", "S3 compatible endpoint")
+	flag.StringVar(&cfg.storage.s3.region, "s3-region", "us-east-1", "S3 region")
+	flag.StringVar(&cfg.storage.s3.bucket, "s3-bucket", "openmovies", "S3 bucket")
+	flag.StringVar(&cfg.storage.s3.accessKey, "s3-access-key", os.Getenv("OPENMOVIES_S3_ACCESS_KEY"), "S3 access key")
+	flag.StringVar(&cfg.storage.s3.secretKey, "s3-secret-key", os.Getenv("OPENMOVIES_S3_SECRET_KEY"), "S3 secret key")
+	flag.Int64Var(&cfg.images.maxSize, "images-max-size", 10<<20, "Largest accepted image upload in bytes")
+	flag.StringVar(&cfg.images.baseURL, "images-base-url", "/v1", "URL prefix that image storage keys are served under")
+	flag.Float64Var(&cfg.similar.weights.Genres, "similar-genre-weight", 3, "Weight of genre overlap in similar movies")
+	flag.Float64Var(&cfg.similar.weights.Year, "similar-year-weight", 1, "Weight of release year proximity in similar movies")
+	flag.Float64Var(&cfg.similar.weights.People, "similar-people-weight", 2, "Weight of shared cast and crew in similar movies")
+	flag.Float64Var(&cfg.similar.weights.Title, "similar-title-weight", 1, "Weight of title similarity in similar movies")
+	flag.DurationVar(&cfg.matviews.refreshInterval, "matviews-refresh-interval", time.Hour, "How often materialized views such as similar movie scores are refreshed")
+	flag.IntVar(&cfg.recommendations.neighbours, "recommendations-neighbours", 50, "Neighbours kept per movie for recommendations")
+	flag.IntVar(&cfg.recommendations.minCoRatings, "recommendations-min-co-ratings", 3, "Users that must have rated both movies of a neighbour pair")
+	flag.DurationVar(&cfg.recommendations.refreshInterval, "recommendations-refresh-interval", 6*time.Hour, "How often movie neighbours are recomputed")
+	flag.IntVar(&cfg.stats.buffer, "stats-buffer", 10000, "View and search events buffered before new ones are dropped")
+	flag.DurationVar(&cfg.stats.flushInterval, "stats-flush-interval", 10*time.Second, "How often buffered view and search events are written")
+	flag.DurationVar(&cfg.webhooks.pollInterval, "webhooks-poll-interval", 5*time.Second, "How often due webhook deliveries are picked up")
+	flag.DurationVar(&cfg.webhooks.timeout, "webhooks-timeout", 10*time.Second, "Timeout of a single webhook delivery attempt")
+	flag.IntVar(&cfg.webhooks.maxAttempts, "webhooks-max-attempts", 8, "Attempts before a webhook delivery is marked dead")
+	flag.DurationVar(&cfg.webhooks.backoffBase, "webhooks-backoff-base", 30*time.Second, "Wait after the first failed webhook delivery, doubled for each further failure")
+	flag.DurationVar(&cfg.webhooks.backoffMax, "webhooks-backoff-max", 6*time.Hour, "Longest wait between webhook delivery attempts")
+	flag.BoolVar(&cfg.webhooks.allowPrivate, "webhooks-allow-private", false, "Allow webhooks to loopback, private and link-local addresses (for local development)")
+	flag.DurationVar(&cfg.events.retention, "events-retention", 7*24*time.Hour, "How long movie events stay available for resuming event streams")
+	flag.IntVar(&cfg.jobs.concurrency, "jobs-concurrency", 4, "Background jobs run at the same time")
+	flag.DurationVar(&cfg.jobs.pollInterval, "jobs-poll-interval", time.Second, "How often due background jobs are picked up")
+	flag.DurationVar(&cfg.jobs.timeout, "jobs-timeout", time.Minute, "Timeout of a single background job run")
+	flag.IntVar(&cfg.jobs.maxAttempts, "jobs-max-attempts", 10, "Attempts before a background job is marked dead")
+	flag.DurationVar(&cfg.jobs.backoffBase, "jobs-backoff-base", 10*time.Second, "Wait after the first failed job run, doubled for each further failure")
+	flag.DurationVar(&cfg.jobs.backoffMax, "jobs-backoff-max", time.Hour, "Longest wait between job runs")
+	flag.DurationVar(&cfg.jobs.drainTimeout, "jobs-drain-timeout", 15*time.Second, "How long running jobs may take to finish on shutdown")
+	flag.StringVar(&cfg.tokens.purgeSchedule, "tokens-purge-schedule", "@hourly", "Cron schedule for removing expired tokens")
+	flag.IntVar(&cfg.users.unactivatedDays, "users-unactivated-days", 30, "Days after which accounts that were never activated are deleted")
+	flag.StringVar(&cfg.users.purgeSchedule, "users-purge-schedule", "@daily", "Cron schedule for deleting accounts that were never activated")
 	flag.Parse()
-	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
+	if cfg.mailer.backend == "" {
+		cfg.mailer.backend = "smtp"
+		if cfg.env == "development" {
+			cfg.mailer.backend = "log"
+		}
+	}
+	logLevel := jsonlog.LevelInfo
+	if cfg.env == "development" {
+		logLevel = jsonlog.LevelDebug
+	}
+	logger := jsonlog.New(os.Stdout, logLevel)
+
+	if err := cfg.validate(); err != nil {
+		logger.LogFatal(err, nil)
+	}
 
 	validate := validator.New(validator.WithRequiredStructEnabled())
+	validate.RegisterStructValidation(data.FiltersStructLevelValidation, data.Filters{})
 	db, err := openDB(cfg)
 	defer db.Close()
 	if err != nil {
 		logger.LogFatal(err, nil)
 	}
+	store, err := openStorage(cfg)
+	if err != nil {
+		logger.LogFatal(err, nil)
+	}
+	mailTemplates, err := mailer.LoadTemplates()
+	if err != nil {
+		logger.LogFatal(err, nil)
+	}
+	transport, err := openMailTransport(cfg, logger)
+	if err != nil {
+		logger.LogFatal(err, nil)
+	}
+	models := data.NewModels(db)
 	app := application{
-		logger:        jsonlog.New(os.Stdout, jsonlog.LevelInfo),
+		logger:        logger,
 		config:        cfg,
 		validator:     validate,
-		models:        data.NewModels(db),
+		models:        models,
 		schemaDecoder: schema.NewDecoder(),
-		mailer:        mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		mailer:        queuedMailer{templates: mailTemplates, queue: models.Mail, sender: cfg.mailer.sender},
+		mailTemplates: mailTemplates,
+		mailTransport: transport,
+		storage:       store,
+		statEvents:    make(chan statEvent, cfg.stats.buffer),
+		events:        newEventBroker(),
 		wg:            sync.WaitGroup{},
 	}
 	err = app.serve()
@@ -81,6 +250,61 @@ func main() {
 	}
 }
 
+// validate rejects flag values the server cannot run with.
+func (cfg config) validate() error {
+	if cfg.trash.purgeInterval <= 0 {
+		return errors.New("-trash-purge-interval must be greater than zero")
+	}
+	if cfg.matviews.refreshInterval <= 0 {
+		return errors.New("-matviews-refresh-interval must be greater than zero")
+	}
+	if cfg.recommendations.refreshInterval <= 0 {
+		return errors.New("-recommendations-refresh-interval must be greater than zero")
+	}
+	if cfg.stats.buffer < 1 {
+		return errors.New("-stats-buffer must be at least 1")
+	}
+	if cfg.stats.flushInterval <= 0 {
+		return errors.New("-stats-flush-interval must be greater than zero")
+	}
+	if cfg.webhooks.pollInterval <= 0 {
+		return errors.New("-webhooks-poll-interval must be greater than zero")
+	}
+	if cfg.webhooks.timeout <= 0 {
+		return errors.New("-webhooks-timeout must be greater than zero")
+	}
+	if cfg.jobs.pollInterval <= 0 {
+		return errors.New("-jobs-poll-interval must be greater than zero")
+	}
+	if cfg.jobs.timeout <= 0 {
+		return errors.New("-jobs-timeout must be greater than zero")
+	}
+	if cfg.jobs.drainTimeout < 0 {
+		return errors.New("-jobs-drain-timeout must not be negative")
+	}
+	if cfg.jobs.concurrency < 1 {
+		return errors.New("-jobs-concurrency must be at least 1")
+	}
+	if cfg.mailQueue.pollInterval <= 0 {
+		return errors.New("-mail-poll-interval must be greater than zero")
+	}
+	if cfg.mailQueue.domainRate <= 0 {
+		return errors.New("-mail-domain-rate must be greater than zero")
+	}
+	if cfg.mailQueue.domainBurst < 1 {
+		return errors.New("-mail-domain-burst must be at least 1")
+	}
+	if cfg.env == "production" && cfg.mailer.unsubscribeSecret == "" {
+		return errors.New("-mail-unsubscribe-secret is required in production")
+	}
+	// Neither transport delivers anything, so users would never get their
+	// activation and reset mail.
+	if cfg.env == "production" && (cfg.mailer.backend == "log" || cfg.mailer.backend == "memory") {
+		return fmt.Errorf("-mailer=%s cannot be used in production", cfg.mailer.backend)
+	}
+	return nil
+}
+
 func openDB(cfg config) (*sql.DB, error) {
 	db, err := sql.Open("pgx", cfg.db.dsn)
 	if err != nil {
@@ -96,3 +320,30 @@ func openDB(cfg config) (*sql.DB, error) {
 
 	return db, nil
 }
+
+func openStorage(cfg config) (storage.Storage, error) {
+	switch cfg.storage.backend {
+	case "local":
+		return storage.NewLocal(cfg.storage.dir), nil
+	case "s3":
+		s3 := cfg.storage.s3
+		return storage.NewS3(s3.endpoint, s3.region, s3.bucket, s3.accessKey, s3.secretKey)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.storage.backend)
+	}
+}
+
+func openMailTransport(cfg config, logger *jsonlog.Logger) (mailer.Transport, error) {
+	switch cfg.mailer.backend {
+	case "smtp":
+		return mailer.NewSMTP(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password), nil
+	case "file":
+		return mailer.NewFile(cfg.mailer.dir), nil
+	case "log":
+		return mailer.NewLog(logger), nil
+	case "memory":
+		return mailer.NewMemory(100), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer backend %q", cfg.mailer.backend)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"openmovies/internal/data"
+	"openmovies/internal/jsonpatch"
+)
+
+// applyMoviePartialDto applies the original ad-hoc patch shape, where every
+// present field replaces the stored one.
+func (app *application) applyMoviePartialDto(w http.ResponseWriter, r *http.Request, movie *data.Movie) bool {
+	var input MoviePartialDto
+	err := app.decodeJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return false
+	}
+
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return false
+	}
+
+	if input.Title != nil {
+		movie.Title = *input.Title
+	}
+	if input.Year != nil {
+		movie.Year = *input.Year
+	}
+	if input.Runtime != nil {
+		movie.Runtime = *input.Runtime
+	}
+	if input.Genres != nil {
+		genres := app.canonicalGenres(w, r, input.Genres)
+		if genres == nil {
+			return false
+		}
+		movie.Genres = genres
+	}
+	for source, externalId := range input.ExternalIDs {
+		if movie.ExternalIDs == nil {
+			movie.ExternalIDs = map[string]string{}
+		}
+		if externalId == nil {
+			delete(movie.ExternalIDs, source)
+			continue
+		}
+		movie.ExternalIDs[source] = *externalId
+	}
+	return true
+}
+
+// applyMoviePatchDocument applies a JSON Merge Patch or JSON Patch document to
+// the MovieDto representation of movie. The patched document has to pass the
+// same validation as a full PUT.
+func (app *application) applyMoviePatchDocument(w http.ResponseWriter, r *http.Request, mediaType string, movie *data.Movie) bool {
+	maxBytes := 1_048_576
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxBytes)))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return false
+	}
+
+	current, err := json.Marshal(MovieDto{
+		Title:       movie.Title,
+		Year:        movie.Year,
+		Runtime:     movie.Runtime,
+		Genres:      movie.Genres,
+		ExternalIDs: movie.ExternalIDs,
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	var patched []byte
+	switch mediaType {
+	case jsonpatch.MergePatchContentType:
+		patched, err = jsonpatch.MergePatch(current, body)
+	default:
+		patched, err = jsonpatch.Apply(current, body)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, jsonpatch.ErrTestFailed):
+			app.errorResponse(w, r, http.StatusConflict, err.Error())
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return false
+	}
+
+	var input MovieDto
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&input)
+	if err != nil {
+		app.badRequestResponse(w, r, errors.New("patched document is not a valid movie"))
+		return false
+	}
+
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return false
+	}
+	genres := app.canonicalGenres(w, r, input.Genres)
+	if genres == nil {
+		return false
+	}
+
+	movie.Title = input.Title
+	movie.Year = input.Year
+	movie.Runtime = input.Runtime
+	movie.Genres = genres
+	// The document always carries the current identifiers, so a missing
+	// externalIds member means the patch removed all of them.
+	movie.ExternalIDs = input.ExternalIDs
+	if movie.ExternalIDs == nil {
+		movie.ExternalIDs = map[string]string{}
+	}
+	return true
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"openmovies/internal/data"
+	"strconv"
+)
+
+func (app *application) getMovieRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	input := data.NewRevisionFilters()
+	err = app.schemaDecoder.Decode(&input, r.URL.Query())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	revisions, metadata, err := app.models.Revisions.GetAllForMovie(id, input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"revisions": revisions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getMovieRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	version, err := strconv.ParseInt(mux.Vars(r)["version"], 10, 32)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	revision, err := app.models.Revisions.GetByVersion(id, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"revision": revision}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreMovieRevisionHandler copies the fields of an earlier revision onto the
+// current movie and saves it through the usual versioned update, so the
+// restore itself shows up as a new revision. The client has to name the
+// version it expects to overwrite in If-Match, since a restore replaces every
+// field at once.
+func (app *application) restoreMovieRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	version, err := strconv.ParseInt(mux.Vars(r)["version"], 10, 32)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.GetById(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if r.Header.Get("If-Match") == "" {
+		app.preconditionRequiredResponse(w, r)
+		return
+	}
+	ok, _ := app.checkIfMatch(w, r, movie)
+	if !ok {
+		return
+	}
+
+	revision, err := app.models.Revisions.GetByVersion(id, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Genres may have been merged or renamed since the revision was taken.
+	genres := app.canonicalGenres(w, r, revision.Snapshot.Genres)
+	if genres == nil {
+		return
+	}
+
+	movie.Title = revision.Snapshot.Title
+	movie.Year = revision.Snapshot.Year
+	movie.Runtime = revision.Snapshot.Runtime
+	movie.Genres = genres
+	// Snapshots leave out an empty set of external ids.
+	movie.ExternalIDs = revision.Snapshot.ExternalIDs
+	if movie.ExternalIDs == nil {
+		movie.ExternalIDs = map[string]string{}
+	}
+
+	err = app.models.Movies.Update(movie, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			app.duplicateExternalIDResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	setMovieValidators(headers, movie)
+	err = app.writeJson(w, http.StatusOK, envelop{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -4,16 +4,21 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
+	"mime"
 	"net/http"
 	"openmovies/internal/data"
+	"openmovies/internal/jsonpatch"
+	"slices"
 	"strconv"
+	"strings"
 )
 
 type MovieDto struct {
-	Title   string       `json:"title" validate:"required,max=500"`
-	Year    int32        `json:"year" validate:"required,min=1888"`
-	Runtime data.Runtime `json:"runtime" validate:"gt=0"`
-	Genres  []string     `json:"genres" validate:"required,min=1,max=5,unique"`
+	Title       string            `json:"title" validate:"required,max=500"`
+	Year        int32             `json:"year" validate:"required,min=1888"`
+	Runtime     data.Runtime      `json:"runtime" validate:"gt=0"`
+	Genres      []string          `json:"genres" validate:"required,min=1,max=5,unique"`
+	ExternalIDs map[string]string `json:"externalIds,omitempty" validate:"omitempty,max=10,dive,keys,oneof=imdb tmdb wikidata letterboxd,endkeys,required,max=100"`
 }
 
 func (app *application) postMovieHandler(w http.ResponseWriter, r *http.Request) {
@@ -29,20 +34,31 @@ func (app *application) postMovieHandler(w http.ResponseWriter, r *http.Request)
 		app.fieldValidationResponse(w, r, apiErr)
 		return
 	}
+	genres := app.canonicalGenres(w, r, input.Genres)
+	if genres == nil {
+		return
+	}
 	movie := &data.Movie{
-		Title:   input.Title,
-		Year:    input.Year,
-		Runtime: input.Runtime,
-		Genres:  input.Genres,
+		Title:       input.Title,
+		Year:        input.Year,
+		Runtime:     input.Runtime,
+		Genres:      genres,
+		ExternalIDs: input.ExternalIDs,
 	}
-	err = app.models.Movies.Insert(movie)
+	err = app.models.Movies.Insert(movie, app.contextGetUser(r).ID)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			app.duplicateExternalIDResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	setMovieValidators(headers, movie)
 
 	err = app.writeJson(w, http.StatusOK, envelop{"movie": movie}, headers)
 	if err != nil {
@@ -61,20 +77,120 @@ func (app *application) getMovieHandler(w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
+			app.redirectMergedMovie(w, r, id)
+
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeMovieResponse(w, r, movie)
+}
 
+// redirectMergedMovie answers a lookup of a movie that was merged away with a
+// permanent redirect to the movie it was folded into, or 404 otherwise.
+func (app *application) redirectMergedMovie(w http.ResponseWriter, r *http.Request, id int64) {
+	movieId, err := app.models.Movies.GetRedirect(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
+	http.Redirect(w, r, fmt.Sprintf("/v1/movies/%d", movieId), http.StatusMovedPermanently)
+}
 
-	err = app.writeJson(w, http.StatusOK, envelop{"movie": movie}, nil)
+// writeMovieResponse sends the full representation of a single movie, with
+// its credits and collections, honouring conditional GET headers.
+func (app *application) writeMovieResponse(w http.ResponseWriter, r *http.Request, movie *data.Movie) {
+	var err error
+	movie.Credits, err = app.models.Credits.GetAllForMovie(movie.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	movie.Collections, err = app.models.Collections.GetForMovie(movie.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	movie.Titles, err = app.models.Titles.GetAllForMovie(movie.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	movie.Translations, err = app.models.Translations.GetAllForMovie(movie.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.attachImages(movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.recordView(movie.ID)
+
+	headers := make(http.Header)
+	if !app.localizeMovies(w, r, headers, movie) {
+		return
+	}
+	contentLanguages := []string{}
+	for _, locale := range []string{movie.TitleLocale, movie.TranslationLocale} {
+		if locale != "" && !slices.Contains(contentLanguages, locale) {
+			contentLanguages = append(contentLanguages, locale)
+		}
+	}
+	if len(contentLanguages) > 0 {
+		headers.Set("Content-Language", strings.Join(contentLanguages, ", "))
+	}
+	setMovieValidators(headers, movie)
+	if notModified(r, movie) {
+		for key, value := range headers {
+			w.Header()[key] = value
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+func (app *application) getMovieByExternalIDHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.models.Movies.GetIdByExternalID(mux.Vars(r)["source"], mux.Vars(r)["externalId"])
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	movie, err := app.models.Movies.GetById(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	app.writeMovieResponse(w, r, movie)
+}
+
 func (app *application) putMovieHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 	if err != nil {
@@ -93,6 +209,11 @@ func (app *application) putMovieHandler(w http.ResponseWriter, r *http.Request)
 		}
 		return
 	}
+	ok, conditional := app.checkIfMatch(w, r, movie)
+	if !ok {
+		return
+	}
+
 	var input MovieDto
 	err = app.decodeJson(w, r, &input)
 	if err != nil {
@@ -105,23 +226,36 @@ func (app *application) putMovieHandler(w http.ResponseWriter, r *http.Request)
 		app.fieldValidationResponse(w, r, apiErr)
 		return
 	}
+	genres := app.canonicalGenres(w, r, input.Genres)
+	if genres == nil {
+		return
+	}
 	movie.Title = input.Title
 	movie.Year = input.Year
 	movie.Runtime = input.Runtime
-	movie.Genres = input.Genres
+	movie.Genres = genres
+	if input.ExternalIDs != nil {
+		movie.ExternalIDs = input.ExternalIDs
+	}
 
-	err = app.models.Movies.Update(movie)
+	err = app.models.Movies.Update(movie, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrEditConflict) && conditional:
+			app.preconditionFailedResponse(w, r)
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			app.duplicateExternalIDResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJson(w, http.StatusOK, envelop{"movie": movie}, nil)
+	headers := make(http.Header)
+	setMovieValidators(headers, movie)
+	err = app.writeJson(w, http.StatusOK, envelop{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -134,11 +268,34 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Movies.Delete(id)
+	// Without an If-Match header nobody needs the current state, so the
+	// extra read is skipped and the delete is unconditional.
+	var version int32
+	if r.Header.Get("If-Match") != "" || app.config.requireIfMatch {
+		movie, err := app.models.Movies.GetById(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		ok, _ := app.checkIfMatch(w, r, movie)
+		if !ok {
+			return
+		}
+		version = movie.Version
+	}
+
+	err = app.models.Movies.Delete(id, version, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -160,6 +317,9 @@ type MoviePartialDto struct {
 	Year    *int32        `json:"year" validate:"omitnil,min=1888"`
 	Runtime *data.Runtime `json:"runtime" validate:"omitnil,gt=0"`
 	Genres  []string      `json:"genres" validate:"omitnil,min=1,max=5,unique"`
+	// ExternalIDs entries are merged into the stored ones, a null value
+	// removes the identifier for that source.
+	ExternalIDs map[string]*string `json:"externalIds" validate:"omitempty,max=10,dive,keys,oneof=imdb tmdb wikidata letterboxd,endkeys,omitnil,min=1,max=100"`
 }
 
 func (app *application) patchMovieHandler(w http.ResponseWriter, r *http.Request) {
@@ -180,53 +340,54 @@ func (app *application) patchMovieHandler(w http.ResponseWriter, r *http.Request
 		}
 		return
 	}
-
-	var input MoviePartialDto
-	err = app.decodeJson(w, r, &input)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
+	ok, conditional := app.checkIfMatch(w, r, movie)
+	if !ok {
 		return
 	}
 
-	if input.Title != nil {
-		movie.Title = *input.Title
-	}
-	if input.Year != nil {
-		movie.Year = *input.Year
-	}
-	if input.Runtime != nil {
-		movie.Runtime = *input.Runtime
-	}
-	if input.Genres != nil {
-		movie.Genres = input.Genres
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case jsonpatch.MergePatchContentType, jsonpatch.JSONPatchContentType:
+		ok = app.applyMoviePatchDocument(w, r, mediaType, movie)
+	case "", "application/json":
+		ok = app.applyMoviePartialDto(w, r, movie)
+	default:
+		app.unsupportedMediaTypeResponse(w, r)
+		return
 	}
-
-	apiErr := app.validateInput(input)
-	if apiErr != nil {
-		app.fieldValidationResponse(w, r, apiErr)
+	if !ok {
 		return
 	}
 
-	err = app.models.Movies.Update(movie)
+	err = app.models.Movies.Update(movie, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrEditConflict) && conditional:
+			app.preconditionFailedResponse(w, r)
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			app.duplicateExternalIDResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJson(w, http.StatusOK, envelop{"movie": movie}, nil)
+	headers := make(http.Header)
+	setMovieValidators(headers, movie)
+	err = app.writeJson(w, http.StatusOK, envelop{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
 func (app *application) getMovies(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	qs.Del("lang")
+
 	input := data.NewMovieFilters()
-	err := app.schemaDecoder.Decode(&input, r.URL.Query())
+	err := app.schemaDecoder.Decode(&input, qs)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
@@ -236,13 +397,30 @@ func (app *application) getMovies(w http.ResponseWriter, r *http.Request) {
 		app.fieldValidationResponse(w, r, apiErr)
 		return
 	}
+	err = app.models.Genres.ResolveFilter(input.Genres)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 	movies, metadata, err := app.models.Movies.Get(input)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	if input.Title != "" {
+		app.recordSearchHits(movies)
+	}
+	err = app.attachImages(movies...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	if !app.localizeMovies(w, r, headers, movies...) {
+		return
+	}
 
-	err = app.writeJson(w, http.StatusOK, envelop{"movies": movies, "metadata": metadata}, nil)
+	err = app.writeJson(w, http.StatusOK, envelop{"movies": movies, "metadata": metadata}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
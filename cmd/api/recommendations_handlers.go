@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"openmovies/internal/data"
+)
+
+func (app *application) getRecommendationsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	qs.Del("lang")
+	input := data.NewRecommendationFilters()
+	err := app.schemaDecoder.Decode(&input, qs)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	recommended, metadata, source, err := app.models.Recommendations.ForUser(app.contextGetUser(r).ID, input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	movies := make([]*data.Movie, len(recommended))
+	for i, movie := range recommended {
+		movies[i] = movie.Movie
+	}
+	err = app.attachImages(movies...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	if !app.localizeMovies(w, r, headers, movies...) {
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"movies": recommended, "source": source, "metadata": metadata}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// refreshNeighbours recomputes the item-item neighbours that personal
+// recommendations are built from.
+func (app *application) refreshNeighbours(ctx context.Context) (string, error) {
+	cfg := app.config.recommendations
+	stored, err := app.models.Recommendations.RefreshNeighbours(ctx, cfg.neighbours, cfg.minCoRatings)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("stored %d neighbours", stored), nil
+}
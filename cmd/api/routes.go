@@ -13,15 +13,102 @@ func (app *application) routes() http.Handler {
 
 	router.HandleFunc("/v1/movies", app.requirePermission("movies:read", app.getMovies)).Methods(http.MethodGet)
 	router.HandleFunc("/v1/movies", app.requirePermission("movies:write", app.postMovieHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/v1/movies/trash", app.requirePermission("movies:write", app.getTrashedMoviesHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/movies/trending", app.requirePermission("movies:read", app.getTrendingMoviesHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/movies/duplicates", app.requirePermission("movies:write", app.getDuplicateCandidatesHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/movies/by-external/{source}/{externalId}", app.requirePermission("movies:read", app.getMovieByExternalIDHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/movies/events", app.requirePermission("movies:read", app.movieEventsHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/movies/export", app.requirePermission("movies:read", app.exportMoviesHandler)).Methods(http.MethodGet)
 	router.HandleFunc("/v1/movies/{id:[0-9]+}", app.requirePermission("movies:write", app.getMovieHandler)).Methods(http.MethodGet)
 	router.HandleFunc("/v1/movies/{id:[0-9]+}", app.requirePermission("movies:write", app.putMovieHandler)).Methods(http.MethodPut)
 	router.HandleFunc("/v1/movies/{id:[0-9]+}", app.requirePermission("movies:write", app.patchMovieHandler)).Methods(http.MethodPatch)
 	router.HandleFunc("/v1/movies/{id:[0-9]+}", app.requirePermission("movies:write", app.deleteMovieHandler)).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/movies/{id:[0-9]+}/ratings", app.requirePermission("ratings:write", app.putRatingHandler)).Methods(http.MethodPut)
+	router.HandleFunc("/v1/movies/{id:[0-9]+}/ratings", app.requirePermission("ratings:write", app.deleteRatingHandler)).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/movies/{id:[0-9]+}/reviews", app.requirePermission("movies:read", app.getMovieReviewsHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/movies/{id:[0-9]+}/reviews", app.requirePermission("reviews:write", app.postReviewHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/v1/movies/{id:[0-9]+}/credits", app.requirePermission("movies:write", app.postCreditHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/v1/movies/{id:[0-9]+}/credits/{creditId:[0-9]+}", app.requirePermission("movies:write", app.deleteCreditHandler)).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/movies/{id:[0-9]+}/images", app.requirePermission("movies:write", app.postMovieImageHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/v1/movies/{id:[0-9]+}/images/{imageId:[0-9]+}", app.requirePermission("movies:write", app.deleteMovieImageHandler)).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/movies/{id:[0-9]+}/titles", app.requirePermission("movies:read", app.getMovieTitlesHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/movies/{id:[0-9]+}/titles", app.requirePermission("movies:write", app.putMovieTitlesHandler)).Methods(http.MethodPut)
+	router.HandleFunc("/v1/movies/{id:[0-9]+}/translations", app.requirePermission("movies:read", app.getMovieTranslationsHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/movies/{id:[0-9]+}/translations", app.requirePermission("movies:write", app.putMovieTranslationsHandler)).Methods(http.MethodPut)
+	router.HandleFunc("/v1/movies/{id:[0-9]+}/stats", app.requirePermission("stats:read", app.getMovieStatsHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/movies/{id:[0-9]+}/similar", app.requirePermission("movies:read", app.getSimilarMoviesHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/movies/{id:[0-9]+}/merge", app.requirePermission("movies:write", app.mergeMovieHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/v1/movies/{id:[0-9]+}/restore", app.requirePermission("movies:write", app.restoreMovieHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/v1/movies/{id:[0-9]+}/revisions", app.requirePermission("movies:read", app.getMovieRevisionsHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/movies/{id:[0-9]+}/revisions/{version:[0-9]+}", app.requirePermission("movies:read", app.getMovieRevisionHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/movies/{id:[0-9]+}/revisions/{version:[0-9]+}/restore", app.requirePermission("movies:write", app.restoreMovieRevisionHandler)).Methods(http.MethodPost)
 
+	router.HandleFunc("/v1/images/{id:[0-9]+}/{file}", app.requirePermission("movies:read", app.serveImageHandler)).Methods(http.MethodGet, http.MethodHead)
+	router.HandleFunc("/v1/collections", app.requirePermission("movies:read", app.getCollectionsHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/collections", app.requirePermission("movies:write", app.postCollectionHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/v1/collections/{id:[0-9]+}", app.requirePermission("movies:read", app.getCollectionHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/collections/{id:[0-9]+}", app.requirePermission("movies:write", app.putCollectionHandler)).Methods(http.MethodPut)
+	router.HandleFunc("/v1/collections/{id:[0-9]+}", app.requirePermission("movies:write", app.deleteCollectionHandler)).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/collections/{id:[0-9]+}/movies", app.requirePermission("movies:write", app.putCollectionMoviesHandler)).Methods(http.MethodPut)
+
+	router.HandleFunc("/v1/genres", app.requirePermission("movies:read", app.getGenresHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/genres", app.requirePermission("genres:write", app.postGenreHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/v1/genres/{slug}", app.requirePermission("genres:write", app.putGenreHandler)).Methods(http.MethodPut)
+	router.HandleFunc("/v1/genres/{slug}", app.requirePermission("genres:write", app.deleteGenreHandler)).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/genres/{slug}/merge", app.requirePermission("genres:write", app.mergeGenreHandler)).Methods(http.MethodPost)
+
+	router.HandleFunc("/v1/people", app.requirePermission("movies:read", app.getPeopleHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/people", app.requirePermission("movies:write", app.postPersonHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/v1/people/{id:[0-9]+}", app.requirePermission("movies:read", app.getPersonHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/people/{id:[0-9]+}", app.requirePermission("movies:write", app.putPersonHandler)).Methods(http.MethodPut)
+	router.HandleFunc("/v1/people/{id:[0-9]+}", app.requirePermission("movies:write", app.deletePersonHandler)).Methods(http.MethodDelete)
+
+	router.HandleFunc("/v1/reviews/moderation", app.requirePermission("reviews:moderate", app.getModerationQueueHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/reviews/{id:[0-9]+}", app.requirePermission("movies:read", app.getReviewHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/reviews/{id:[0-9]+}", app.requirePermission("reviews:write", app.putReviewHandler)).Methods(http.MethodPut)
+	router.HandleFunc("/v1/reviews/{id:[0-9]+}", app.requirePermission("reviews:write", app.deleteReviewHandler)).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/reviews/{id:[0-9]+}/flags", app.requireActivatedUser(app.flagReviewHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/v1/reviews/{id:[0-9]+}/moderation", app.requirePermission("reviews:moderate", app.moderateReviewHandler)).Methods(http.MethodPut)
+
+	router.HandleFunc("/v1/lists", app.requireActivatedUser(app.getListsHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/lists", app.requireActivatedUser(app.postListHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/v1/lists/shared/{token}", app.getSharedListHandler).Methods(http.MethodGet)
+	router.HandleFunc("/v1/lists/{id:[0-9]+}", app.getListHandler).Methods(http.MethodGet)
+	router.HandleFunc("/v1/lists/{id:[0-9]+}", app.requireActivatedUser(app.patchListHandler)).Methods(http.MethodPatch)
+	router.HandleFunc("/v1/lists/{id:[0-9]+}", app.requireActivatedUser(app.deleteListHandler)).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/lists/{id:[0-9]+}/items", app.requireActivatedUser(app.postListItemHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/v1/lists/{id:[0-9]+}/items/{movieId:[0-9]+}", app.requireActivatedUser(app.deleteListItemHandler)).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/lists/{id:[0-9]+}/order", app.requireActivatedUser(app.putListOrderHandler)).Methods(http.MethodPut)
+
+	router.HandleFunc("/v1/webhooks", app.requirePermission("webhooks:manage", app.getWebhooksHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/webhooks", app.requirePermission("webhooks:manage", app.postWebhookHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/v1/webhooks/{id:[0-9]+}", app.requirePermission("webhooks:manage", app.getWebhookHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/webhooks/{id:[0-9]+}", app.requirePermission("webhooks:manage", app.patchWebhookHandler)).Methods(http.MethodPatch)
+	router.HandleFunc("/v1/webhooks/{id:[0-9]+}", app.requirePermission("webhooks:manage", app.deleteWebhookHandler)).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/webhooks/{id:[0-9]+}/deliveries", app.requirePermission("webhooks:manage", app.getWebhookDeliveriesHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/webhooks/{id:[0-9]+}/deliveries/{deliveryId:[0-9]+}/redeliver", app.requirePermission("webhooks:manage", app.redeliverWebhookHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/v1/jobs", app.requirePermission("jobs:manage", app.getJobsHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/jobs/{id:[0-9]+}", app.requirePermission("jobs:manage", app.getJobHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/jobs/{id:[0-9]+}/retry", app.requirePermission("jobs:manage", app.retryJobHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/v1/mail/unsubscribe", app.unsubscribeMailHandler).Methods(http.MethodPost)
+	router.HandleFunc("/v1/mail/messages", app.requirePermission("mail:manage", app.getMailMessagesHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/mail/messages/{id:[0-9]+}", app.requirePermission("mail:manage", app.getMailMessageHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/mail/messages/{id:[0-9]+}/resend", app.requirePermission("mail:manage", app.resendMailMessageHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/v1/mail/suppressions", app.requirePermission("mail:manage", app.getMailSuppressionsHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/mail/suppressions", app.requirePermission("mail:manage", app.postMailSuppressionHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/v1/mail/suppressions/{email}", app.requirePermission("mail:manage", app.deleteMailSuppressionHandler)).Methods(http.MethodDelete)
 	router.HandleFunc("/v1/users", app.registerUserHandler).Methods(http.MethodPost)
+	router.HandleFunc("/v1/users/me/recommendations", app.requireActivatedUser(app.getRecommendationsHandler)).Methods(http.MethodGet)
 	router.HandleFunc("/v1/users/activate", app.activateUserHandler).Methods(http.MethodPut)
 	router.HandleFunc("/v1/users/auth", app.authenticateHandler).Methods(http.MethodPut)
 
+	if app.config.env == "development" {
+		router.HandleFunc("/v1/debug/mail", app.requirePermission("mail:manage", app.getCapturedMailHandler)).Methods(http.MethodGet)
+		router.HandleFunc("/v1/debug/mail", app.requirePermission("mail:manage", app.deleteCapturedMailHandler)).Methods(http.MethodDelete)
+		router.HandleFunc("/v1/debug/mail/templates", app.requirePermission("mail:manage", app.getMailTemplatesHandler)).Methods(http.MethodGet)
+		router.HandleFunc("/v1/debug/mail/templates/{name}", app.requirePermission("mail:manage", app.previewMailTemplateHandler)).Methods(http.MethodGet)
+	}
+
 	router.MethodNotAllowedHandler = http.HandlerFunc(app.methodNotAllowedResponse)
 	router.NotFoundHandler = http.HandlerFunc(app.notFoundResponse)
 
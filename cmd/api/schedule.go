@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"openmovies/internal/scheduler"
+	"strings"
+	"time"
+)
+
+// newScheduler sets up the periodic maintenance jobs. Every replica runs the
+// scheduler, and each run happens on only one of them.
+func (app *application) newScheduler() (*scheduler.Scheduler, error) {
+	tokensSchedule, err := scheduler.Parse(app.config.tokens.purgeSchedule)
+	if err != nil {
+		return nil, fmt.Errorf("tokens-purge-schedule: %w", err)
+	}
+	usersSchedule, err := scheduler.Parse(app.config.users.purgeSchedule)
+	if err != nil {
+		return nil, fmt.Errorf("users-purge-schedule: %w", err)
+	}
+	trashSchedule, err := scheduler.Every(app.config.trash.purgeInterval)
+	if err != nil {
+		return nil, fmt.Errorf("trash-purge-interval: %w", err)
+	}
+	matviewsSchedule, err := scheduler.Every(app.config.matviews.refreshInterval)
+	if err != nil {
+		return nil, fmt.Errorf("matviews-refresh-interval: %w", err)
+	}
+	neighboursSchedule, err := scheduler.Every(app.config.recommendations.refreshInterval)
+	if err != nil {
+		return nil, fmt.Errorf("recommendations-refresh-interval: %w", err)
+	}
+
+	s := scheduler.New(app.models.Maintenance, app.logger)
+	s.Add("purge_trash", trashSchedule, app.purgeTrash)
+	s.Add("refresh_materialized_views", matviewsSchedule, app.refreshMaterializedViews)
+	s.Add("refresh_neighbours", neighboursSchedule, app.refreshNeighbours)
+	s.Add("prune_events", scheduler.MustEvery(time.Hour), app.pruneEvents)
+	s.Add("purge_expired_tokens", tokensSchedule, app.purgeExpiredTokens)
+	s.Add("delete_unactivated_users", usersSchedule, app.deleteUnactivatedUsers)
+	s.Add("prune_mail", scheduler.MustEvery(24*time.Hour), app.pruneMail)
+	return s, nil
+}
+
+func (app *application) refreshMaterializedViews(ctx context.Context) (string, error) {
+	refreshed, err := app.models.Maintenance.RefreshMaterializedViews(ctx)
+	if err != nil {
+		return "", err
+	}
+	return "refreshed " + strings.Join(refreshed, ", "), nil
+}
+
+func (app *application) purgeExpiredTokens(ctx context.Context) (string, error) {
+	purged, err := app.models.Tokens.DeleteExpired()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("purged %d tokens", purged), nil
+}
+
+func (app *application) deleteUnactivatedUsers(ctx context.Context) (string, error) {
+	retention := time.Duration(app.config.users.unactivatedDays) * 24 * time.Hour
+	deleted, err := app.models.Users.DeleteUnactivated(retention)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("deleted %d users", deleted), nil
+}
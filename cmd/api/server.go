@@ -21,6 +21,38 @@ func (app *application) serve() error {
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
+	schedule, err := app.newScheduler()
+	if err != nil {
+		return err
+	}
+
+	// Event streams never finish on their own, so they are ended as soon as
+	// shutdown starts instead of holding it up until the deadline.
+	srv.RegisterOnShutdown(func() {
+		app.events.reset(true)
+	})
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	app.background(func() {
+		app.dispatchWebhooks(jobsCtx)
+	})
+	app.background(func() {
+		app.listenEvents(jobsCtx)
+	})
+	app.background(func() {
+		app.deliverMail(jobsCtx)
+	})
+	app.background(func() {
+		schedule.Run(jobsCtx)
+	})
+	app.background(func() {
+		app.collectStats(jobsCtx)
+	})
+	app.background(func() {
+		app.runJobs(jobsCtx)
+	})
+
 	shutdownErr := make(chan error)
 	go func() {
 		quit := make(chan os.Signal, 1)
@@ -33,15 +65,19 @@ func (app *application) serve() error {
 		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 		defer cancel()
 
+		// Requests are drained first, so the views and background work they
+		// hand off still reach the collectors, which flush once stopped.
+		err := srv.Shutdown(ctx)
+		stopJobs()
 		app.wg.Wait()
-		shutdownErr <- srv.Shutdown(ctx)
+		shutdownErr <- err
 	}()
 
 	app.logger.LogInfo("Starting server", map[string]string{
 		"addr": srv.Addr,
 		"env":  app.config.env,
 	})
-	err := srv.ListenAndServe()
+	err = srv.ListenAndServe()
 	if !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"openmovies/internal/data"
+	"strconv"
+)
+
+func (app *application) getSimilarMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	qs := r.URL.Query()
+	qs.Del("lang")
+	input := data.NewSimilarFilters()
+	err = app.schemaDecoder.Decode(&input, qs)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	_, err = app.models.Movies.GetById(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	similar, metadata, err := app.models.Movies.GetSimilar(id, app.config.similar.weights, input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	movies := make([]*data.Movie, len(similar))
+	for i, movie := range similar {
+		movies[i] = movie.Movie
+	}
+	err = app.attachImages(movies...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	if !app.localizeMovies(w, r, headers, movies...) {
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"movies": similar, "metadata": metadata}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"openmovies/internal/data"
+	"strconv"
+	"time"
+)
+
+type statEvent struct {
+	movieId   int64
+	searchHit bool
+}
+
+// recordView and recordSearchHits hand events to the stats collector. They
+// never block a request: when the buffer is full the event is dropped.
+func (app *application) recordView(movieId int64) {
+	select {
+	case app.statEvents <- statEvent{movieId: movieId}:
+	default:
+	}
+}
+
+func (app *application) recordSearchHits(movies []*data.Movie) {
+	for _, movie := range movies {
+		select {
+		case app.statEvents <- statEvent{movieId: movie.ID, searchHit: true}:
+		default:
+			return
+		}
+	}
+}
+
+// collectStats batches incoming events in memory and writes them out every
+// flush interval, and a last time, with whatever is still buffered, when ctx
+// is cancelled.
+func (app *application) collectStats(ctx context.Context) {
+	ticker := time.NewTicker(app.config.stats.flushInterval)
+	defer ticker.Stop()
+
+	counts := map[int64]*data.MovieCounts{}
+	flush := func() {
+		if len(counts) == 0 {
+			return
+		}
+		err := app.models.Stats.Add(time.Now(), counts)
+		if err != nil {
+			app.logger.LogError(err, map[string]string{"job": "collect_stats"})
+		}
+		counts = map[int64]*data.MovieCounts{}
+	}
+
+	count := func(event statEvent) {
+		c, ok := counts[event.movieId]
+		if !ok {
+			c = &data.MovieCounts{}
+			counts[event.movieId] = c
+		}
+		if event.searchHit {
+			c.SearchHits++
+		} else {
+			c.Views++
+		}
+	}
+
+	for {
+		select {
+		case event := <-app.statEvents:
+			count(event)
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			for {
+				select {
+				case event := <-app.statEvents:
+					count(event)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (app *application) getTrendingMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	qs.Del("lang")
+	input := data.NewTrendingFilters()
+	err := app.schemaDecoder.Decode(&input, qs)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	trending, metadata, err := app.models.Stats.GetTrending(input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	movies := make([]*data.Movie, len(trending))
+	for i, movie := range trending {
+		movies[i] = movie.Movie
+	}
+	err = app.attachImages(movies...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	if !app.localizeMovies(w, r, headers, movies...) {
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"movies": trending, "window": input.Window, "metadata": metadata}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getMovieStatsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	input := struct {
+		Window   string `schema:"window" validate:"oneof=24h 7d 30d"`
+		Interval string `schema:"interval" validate:"oneof=hour day"`
+	}{Window: "7d", Interval: "day"}
+	err = app.schemaDecoder.Decode(&input, r.URL.Query())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	_, err = app.models.Movies.GetById(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	stats, err := app.models.Stats.GetForMovie(id, input.Window, input.Interval)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"stats": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
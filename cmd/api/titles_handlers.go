@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"openmovies/internal/data"
+	"strconv"
+)
+
+type MovieTitleDto struct {
+	Locale    string `json:"locale" validate:"required,bcp47_language_tag"`
+	Title     string `json:"title" validate:"required,max=500"`
+	Alternate bool   `json:"alternate"`
+}
+
+func (app *application) getMovieTitlesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Movies.GetById(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	titles, err := app.models.Titles.GetAllForMovie(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"titles": titles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) putMovieTitlesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Titles []MovieTitleDto `json:"titles" validate:"max=100,dive"`
+	}
+	err = app.decodeJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	titles := make([]*data.MovieTitle, len(input.Titles))
+	displayLocales := map[string]bool{}
+	for i, dto := range input.Titles {
+		locale, err := data.CanonicalLocale(dto.Locale)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		if !dto.Alternate {
+			if displayLocales[locale] {
+				app.fieldValidationResponse(w, r, []apiError{
+					{Field: fmt.Sprintf("titles[%d]", i), Message: "a locale can only have one display title"},
+				})
+				return
+			}
+			displayLocales[locale] = true
+		}
+		titles[i] = &data.MovieTitle{Locale: locale, Title: dto.Title, Alternate: dto.Alternate}
+	}
+
+	err = app.models.Titles.Set(id, titles)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateTitle):
+			app.fieldValidationResponse(w, r, []apiError{
+				{Field: "titles", Message: "a title can only be listed once per locale"},
+			})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	titles, err = app.models.Titles.GetAllForMovie(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"titles": titles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"openmovies/internal/data"
+	"strconv"
+)
+
+type MovieTranslationDto struct {
+	Locale   string `json:"locale" validate:"required,bcp47_language_tag"`
+	Tagline  string `json:"tagline" validate:"max=500"`
+	Overview string `json:"overview" validate:"max=10000"`
+}
+
+func (app *application) getMovieTranslationsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Movies.GetById(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	translations, err := app.models.Translations.GetAllForMovie(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"translations": translations}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) putMovieTranslationsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Translations []MovieTranslationDto `json:"translations" validate:"max=100,dive"`
+	}
+	err = app.decodeJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	translations := make([]*data.MovieTranslation, len(input.Translations))
+	locales := map[string]bool{}
+	for i, dto := range input.Translations {
+		locale, err := data.CanonicalLocale(dto.Locale)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		if locales[locale] {
+			app.fieldValidationResponse(w, r, []apiError{
+				{Field: fmt.Sprintf("translations[%d]", i), Message: "a locale can only be translated once"},
+			})
+			return
+		}
+		locales[locale] = true
+		translations[i] = &data.MovieTranslation{Locale: locale, Tagline: dto.Tagline, Overview: dto.Overview}
+	}
+
+	err = app.models.Translations.Set(id, translations)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	translations, err = app.models.Translations.GetAllForMovie(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"translations": translations}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"openmovies/internal/data"
+	"strconv"
+)
+
+func (app *application) getTrashedMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	input := data.NewMovieFilters()
+	err := app.schemaDecoder.Decode(&input, r.URL.Query())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+	err = app.models.Genres.ResolveFilter(input.Genres)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	movies, metadata, err := app.models.Movies.GetDeleted(input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"movies": movies, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) restoreMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Restore(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	setMovieValidators(headers, movie)
+	err = app.writeJson(w, http.StatusOK, envelop{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// purgeTrash removes movies that have outlived the configured trash
+// retention, and then the images they leave detached.
+func (app *application) purgeTrash(ctx context.Context) (string, error) {
+	purged, err := app.models.Movies.PurgeDeleted(app.config.trash.retention)
+	if err != nil {
+		return "", err
+	}
+
+	// The stored files go first and the records after them.
+	removed, err := app.models.Images.DeleteDetached(app.removeImage)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("purged %d movies, removed %d images", purged, removed), nil
+}
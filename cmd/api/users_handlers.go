@@ -12,6 +12,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Name     string `json:"name" validate:"required"`
 		Email    string `json:"email" validate:"required,email"`
 		Password string `json:"password" validate:"min=6"`
+		Locale   string `json:"locale" validate:"omitempty,bcp47_language_tag"`
 	}
 
 	err := app.decodeJson(w, r, &input)
@@ -26,10 +27,21 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// Mail goes out in the language asked for, or else the one the client
+	// prefers.
+	locale := input.Locale
+	if locale == "" {
+		locales, err := app.requestLocales(r)
+		if err == nil && len(locales) > 0 {
+			locale = locales[0]
+		}
+	}
+
 	user := &data.User{
 		Name:      input.Name,
 		Email:     input.Email,
 		Activated: false,
+		Locale:    locale,
 	}
 
 	err = user.Password.Set(input.Password)
@@ -38,7 +50,16 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Users.Insert(user)
+	// The welcome email is queued with the user, so a failure in between can
+	// neither leave the user without one nor send one for a user that was
+	// never created.
+	err = app.models.Users.Insert(user, func(user *data.User) ([]*data.Job, error) {
+		job, err := app.newJob(welcomeEmailJob{UserID: user.ID}, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		return []*data.Job{job}, nil
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
@@ -51,26 +72,6 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-	app.background(func() {
-		data := map[string]interface{}{
-			"userId":          user.ID,
-			"activationToken": token.Plaintext,
-		}
-		err = app.mailer.Send(user.Email, "user_welcome.tmpl.html", data)
-		if err != nil {
-			app.logger.LogError(err, nil)
-		}
-	})
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
 	err = app.writeJson(w, http.StatusOK, envelop{"user": user}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"net"
+	"net/http"
+	"net/url"
+	"openmovies/internal/backoff"
+	"openmovies/internal/data"
+	"openmovies/internal/webhooks"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type WebhookDto struct {
+	URL    string   `json:"url" validate:"required,url,max=2000"`
+	Events []string `json:"events" validate:"required,min=1,unique,dive,oneof=movie.created movie.updated movie.deleted movie.purged"`
+	Active *bool    `json:"active"`
+}
+
+type WebhookPartialDto struct {
+	URL    *string  `json:"url" validate:"omitnil,url,max=2000"`
+	Events []string `json:"events" validate:"omitnil,min=1,unique,dive,oneof=movie.created movie.updated movie.deleted movie.purged"`
+	Active *bool    `json:"active"`
+}
+
+// checkWebhookURL only lets deliveries go out over http or https, and to
+// hosts that resolve to public addresses. Deliveries check the address they
+// connect to again, since DNS answers can change in between.
+func (app *application) checkWebhookURL(ctx context.Context, raw string) []apiError {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return []apiError{{Field: "url", Message: "must be an absolute http or https url"}}
+	}
+	if app.config.webhooks.allowPrivate {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil || len(ips) == 0 {
+		return []apiError{{Field: "url", Message: "must have a resolvable host"}}
+	}
+	for _, ip := range ips {
+		if !webhooks.IsPublic(ip) {
+			return []apiError{{Field: "url", Message: "must not point to a loopback, private or link-local address"}}
+		}
+	}
+	return nil
+}
+
+func (app *application) getWebhookForRequest(w http.ResponseWriter, r *http.Request) (*data.Webhook, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	webhook, err := app.models.Webhooks.GetById(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return webhook, true
+}
+
+func (app *application) getWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	hooks, err := app.models.Webhooks.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"webhooks": hooks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.getWebhookForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJson(w, http.StatusOK, envelop{"webhook": webhook}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// postWebhookHandler creates a subscription. Its signing secret is returned
+// in this response only.
+func (app *application) postWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var input WebhookDto
+	err := app.decodeJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr == nil {
+		apiErr = app.checkWebhookURL(r.Context(), input.URL)
+	}
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	webhook := &data.Webhook{
+		URL:    input.URL,
+		Secret: secret,
+		Events: input.Events,
+		Active: input.Active == nil || *input.Active,
+	}
+	err = app.models.Webhooks.Insert(webhook)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", "/v1/webhooks/"+strconv.FormatInt(webhook.ID, 10))
+	err = app.writeJson(w, http.StatusCreated, envelop{"webhook": webhook, "secret": secret}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) patchWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.getWebhookForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input WebhookPartialDto
+	err := app.decodeJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr == nil && input.URL != nil {
+		apiErr = app.checkWebhookURL(r.Context(), *input.URL)
+	}
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	if input.URL != nil {
+		webhook.URL = *input.URL
+	}
+	if input.Events != nil {
+		webhook.Events = input.Events
+	}
+	if input.Active != nil {
+		webhook.Active = *input.Active
+	}
+
+	err = app.models.Webhooks.Update(webhook)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"webhook": webhook}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Webhooks.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"message": "webhook successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.getWebhookForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	input := data.NewDeliveryFilters()
+	err := app.schemaDecoder.Decode(&input, r.URL.Query())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	apiErr := app.validateInput(input)
+	if apiErr != nil {
+		app.fieldValidationResponse(w, r, apiErr)
+		return
+	}
+
+	deliveries, metadata, err := app.models.Webhooks.GetDeliveries(webhook.ID, input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelop{"deliveries": deliveries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) redeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	deliveryId, err := strconv.ParseInt(mux.Vars(r)["deliveryId"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	delivery, err := app.models.Webhooks.Redeliver(id, deliveryId)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusAccepted, envelop{"delivery": delivery}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// dispatchWebhooks sends due deliveries from the outbox until ctx is
+// cancelled. A claimed batch is sent concurrently, so every delivery in it
+// completes within its own timeout and the lease only needs to cover one.
+func (app *application) dispatchWebhooks(ctx context.Context) {
+	cfg := app.config.webhooks
+	client := webhooks.NewClient(cfg.timeout, cfg.allowPrivate)
+	ticker := time.NewTicker(cfg.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		due, err := app.models.Webhooks.ClaimDue(20, 2*cfg.timeout)
+		if err != nil {
+			app.logger.LogError(err, map[string]string{"job": "dispatch_webhooks"})
+			continue
+		}
+		var wg sync.WaitGroup
+		for _, delivery := range due {
+			wg.Add(1)
+			go func(delivery *data.DueDelivery) {
+				defer wg.Done()
+				app.sendDelivery(ctx, client, delivery)
+			}(delivery)
+		}
+		wg.Wait()
+	}
+}
+
+// sendDelivery makes one attempt at a claimed delivery and records how it
+// went.
+func (app *application) sendDelivery(ctx context.Context, client *http.Client, delivery *data.DueDelivery) {
+	cfg := app.config.webhooks
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		app.logger.LogError(err, map[string]string{"job": "dispatch_webhooks"})
+		return
+	}
+	status, sendErr := webhooks.Send(ctx, client, webhooks.Request{
+		URL:        delivery.URL,
+		Secret:     delivery.Secret,
+		DeliveryID: delivery.ID,
+		EventType:  delivery.EventType,
+		Body:       body,
+	})
+	if ctx.Err() != nil {
+		// Shutting down: the lease runs out and the delivery is picked up
+		// again without counting this attempt.
+		return
+	}
+	retry := backoff.Exponential(int(delivery.Attempts)+1, cfg.backoffBase, cfg.backoffMax)
+	err = app.models.Webhooks.CompleteDelivery(delivery.ID, delivery.LeaseToken, status, sendErr, retry, cfg.maxAttempts)
+	if err != nil {
+		app.logger.LogError(err, map[string]string{
+			"job":      "dispatch_webhooks",
+			"delivery": strconv.FormatInt(delivery.ID, 10),
+		})
+	}
+}
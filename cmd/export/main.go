@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"io"
+	"openmovies/internal/data"
+	"openmovies/internal/export"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func main() {
+	var (
+		dsn        string
+		format     string
+		output     string
+		title      string
+		genres     string
+		sort       string
+		person     int64
+		director   int64
+		collection int64
+		batchSize  int
+		compress   bool
+	)
+
+	flag.StringVar(&dsn, "db-dsn", os.Getenv("OPENMOVIES_DB_DSN"), "POSTGRES DSN")
+	flag.StringVar(&format, "format", export.FormatCSV, "Export format (csv|jsonl)")
+	flag.StringVar(&output, "o", "-", "Output file, - for stdout")
+	flag.StringVar(&title, "title", "", "Only export movies matching this title search")
+	flag.StringVar(&genres, "genres", "", "Only export movies having all of these comma separated genres")
+	flag.Int64Var(&person, "person", 0, "Only export movies crediting this person id")
+	flag.Int64Var(&director, "director", 0, "Only export movies directed by this person id")
+	flag.Int64Var(&collection, "collection", 0, "Only export movies in this collection or its sub-collections")
+	flag.StringVar(&sort, "sort", "id", "Sort order, same values as GET /v1/movies")
+	flag.IntVar(&batchSize, "batch-size", 1000, "Rows fetched from the cursor per round trip")
+	flag.BoolVar(&compress, "gzip", false, "Gzip the output")
+	flag.Parse()
+
+	if batchSize <= 0 {
+		fmt.Fprintln(os.Stderr, "export: -batch-size must be greater than zero")
+		os.Exit(2)
+	}
+
+	filters := data.NewMovieFilters()
+	filters.Title = title
+	filters.Sort = sort
+	filters.Person = person
+	filters.Director = director
+	filters.Collection = collection
+	if genres != "" {
+		filters.Genres = strings.Split(genres, ",")
+	}
+
+	err := run(dsn, format, output, filters, batchSize, compress)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "export:", err)
+		os.Exit(1)
+	}
+}
+
+func run(dsn, format, output string, filters data.MovieFilters, batchSize int, compress bool) (err error) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Checked before the output file is created, so a typo does not wipe out
+	// an earlier export.
+	if !export.Supported(format) {
+		return export.ErrUnknownFormat
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	validate.RegisterStructValidation(data.FiltersStructLevelValidation, data.Filters{})
+	err = validate.Struct(filters)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err = db.PingContext(pingCtx); err != nil {
+		return err
+	}
+
+	// Writers are closed innermost first, and the first error wins: a
+	// missing gzip trailer or a failed flush or close leaves a truncated
+	// file behind.
+	var closers []func() error
+	defer func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			if closeErr := closers[i](); err == nil {
+				err = closeErr
+			}
+		}
+	}()
+
+	var out io.Writer = os.Stdout
+	if output != "-" {
+		file, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		closers = append(closers, file.Close)
+		out = file
+	}
+
+	buffered := bufio.NewWriter(out)
+	closers = append(closers, buffered.Flush)
+	out = buffered
+
+	if compress {
+		gz := gzip.NewWriter(out)
+		closers = append(closers, gz.Close)
+		out = gz
+	}
+
+	writer, err := export.NewWriter(format, out)
+	if err != nil {
+		return err
+	}
+
+	// Genre names and aliases are resolved as GET /v1/movies does.
+	err = data.GenreModel{DB: db}.ResolveFilter(filters.Genres)
+	if err != nil {
+		return err
+	}
+
+	movies := data.MovieModel{DB: db}
+	err = movies.Export(ctx, filters, batchSize, writer.Write)
+	if err != nil {
+		return err
+	}
+
+	return writer.Flush()
+}
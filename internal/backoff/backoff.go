@@ -0,0 +1,14 @@
+// Package backoff spaces out the retries of the job, mail and webhook queues.
+package backoff
+
+import "time"
+
+// Exponential returns the wait before the next attempt once attempts have
+// failed: base doubled per failure, capped at limit.
+func Exponential(attempts int, base, limit time.Duration) time.Duration {
+	wait := base
+	for i := 1; i < attempts && wait < limit; i++ {
+		wait *= 2
+	}
+	return min(wait, limit)
+}
@@ -0,0 +1,422 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrCollectionCycle = errors.New("collection cycle")
+
+type Collection struct {
+	ID          int64              `json:"id"`
+	CreatedAt   time.Time          `json:"-"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	ParentID    *int64             `json:"parentId"`
+	Position    int32              `json:"position"`
+	Version     int32              `json:"version,omitempty"`
+	Movies      []*CollectionMovie `json:"movies,omitempty"`
+	Children    []*Collection      `json:"children,omitempty"`
+}
+
+type CollectionMovie struct {
+	MovieID  int64  `json:"movieId"`
+	Title    string `json:"title"`
+	Year     int32  `json:"year"`
+	Position int32  `json:"position"`
+}
+
+// CollectionMembership is how a collection shows up on a movie.
+type CollectionMembership struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Position int32  `json:"position"`
+}
+
+type CollectionFilters struct {
+	Parent int64 `schema:"parent" validate:"min=0"`
+	Filters
+}
+
+func NewCollectionFilters() CollectionFilters {
+	return CollectionFilters{
+		Filters: Filters{
+			Page:         1,
+			PageSize:     20,
+			Sort:         "name",
+			SortSafelist: []string{"id", "-id", "name", "-name", "position", "-position"},
+		},
+	}
+}
+
+type CollectionRepository interface {
+	Insert(collection *Collection) error
+	GetById(id int64) (*Collection, error)
+	Get(filters CollectionFilters) ([]*Collection, Metadata, error)
+	GetForMovie(movieId int64) ([]*CollectionMembership, error)
+	Update(collection *Collection) error
+	Delete(id int64) error
+	SetMovies(collectionId int64, movieIds []int64) error
+}
+
+type CollectionModel struct {
+	DB *sql.DB
+}
+
+func (m CollectionModel) Insert(collection *Collection) error {
+	query := `INSERT INTO collections (name, description, parent_id, position) VALUES ($1, $2, $3, $4)
+			RETURNING id, created_at, version`
+	args := []interface{}{collection.Name, collection.Description, collection.ParentID, collection.Position}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&collection.ID, &collection.CreatedAt, &collection.Version)
+}
+
+func (m CollectionModel) GetById(id int64) (*Collection, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_at, name, description, parent_id, position, version FROM collections
+		WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var collection Collection
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&collection.ID,
+		&collection.CreatedAt,
+		&collection.Name,
+		&collection.Description,
+		&collection.ParentID,
+		&collection.Position,
+		&collection.Version,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	collection.Movies, err = m.getMovies(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	children, _, err := m.Get(CollectionFilters{
+		Parent: id,
+		Filters: Filters{
+			Page:         1,
+			PageSize:     1000,
+			Sort:         "position",
+			SortSafelist: []string{"position"},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	collection.Children = children
+	return &collection, nil
+}
+
+func (m CollectionModel) getMovies(ctx context.Context, collectionId int64) ([]*CollectionMovie, error) {
+	query := `
+		SELECT movies.id, movies.title, movies.year, collection_movies.position
+		FROM collection_movies
+		INNER JOIN movies ON movies.id = collection_movies.movie_id
+		WHERE collection_movies.collection_id = $1 AND movies.deleted_at IS NULL
+		ORDER BY collection_movies.position`
+	rows, err := m.DB.QueryContext(ctx, query, collectionId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []*CollectionMovie{}
+	for rows.Next() {
+		var movie CollectionMovie
+		if err = rows.Scan(&movie.MovieID, &movie.Title, &movie.Year, &movie.Position); err != nil {
+			return nil, err
+		}
+		movies = append(movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return movies, nil
+}
+
+// Get lists the direct children of filters.Parent, or the top level
+// collections when Parent is zero.
+func (m CollectionModel) Get(filters CollectionFilters) ([]*Collection, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, created_at, name, description, parent_id, position, version
+		FROM collections
+		WHERE parent_id IS NOT DISTINCT FROM NULLIF($1::bigint, 0)
+		ORDER BY %s, id
+		LIMIT $2 OFFSET $3`, filters.getOrderBySpec())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.Parent, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	collections := []*Collection{}
+	for rows.Next() {
+		var collection Collection
+		err := rows.Scan(
+			&totalRecords,
+			&collection.ID,
+			&collection.CreatedAt,
+			&collection.Name,
+			&collection.Description,
+			&collection.ParentID,
+			&collection.Position,
+			&collection.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		collections = append(collections, &collection)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return collections, calculateMetadata(filters.Page, filters.PageSize, totalRecords), nil
+}
+
+func (m CollectionModel) GetForMovie(movieId int64) ([]*CollectionMembership, error) {
+	query := `
+		SELECT collections.id, collections.name, collection_movies.position
+		FROM collection_movies
+		INNER JOIN collections ON collections.id = collection_movies.collection_id
+		WHERE collection_movies.movie_id = $1
+		ORDER BY collections.name`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	memberships := []*CollectionMembership{}
+	for rows.Next() {
+		var membership CollectionMembership
+		if err = rows.Scan(&membership.ID, &membership.Name, &membership.Position); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, &membership)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return memberships, nil
+}
+
+// collectionAncestors selects a collection, named by $1, and its ancestors.
+// The path guard stops the recursion should a cycle ever make it into the
+// table.
+const collectionAncestors = `
+	WITH RECURSIVE ancestors (id, parent_id, path) AS (
+		SELECT id, parent_id, ARRAY[id] FROM collections WHERE id = $1
+		UNION ALL
+		SELECT collections.id, collections.parent_id, ancestors.path || collections.id FROM collections
+		INNER JOIN ancestors ON collections.id = ancestors.parent_id
+		WHERE NOT collections.id = ANY (ancestors.path)
+	)`
+
+// touchCollectionMovies moves on the live movies of a collection, which show
+// it among their collections.
+func touchCollectionMovies(ctx context.Context, tx *sql.Tx, collectionId int64) error {
+	_, err := touchMovies(ctx, tx, `id IN (SELECT movie_id FROM collection_movies WHERE collection_id = $1)`, collectionId)
+	return err
+}
+
+// Update saves a collection, refusing a parent that would make the collection
+// its own ancestor. The collection and the ancestors of its new parent are
+// row locked before the check, so that two concurrent moves cannot close a
+// cycle between them.
+func (m CollectionModel) Update(collection *Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var name string
+	err = tx.QueryRowContext(ctx, `SELECT name FROM collections WHERE id = $1 FOR UPDATE`, collection.ID).Scan(&name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+		return err
+	}
+
+	if collection.ParentID != nil {
+		query := collectionAncestors + `
+			SELECT id FROM collections WHERE id IN (SELECT id FROM ancestors)
+			ORDER BY id
+			FOR UPDATE`
+		rows, err := tx.QueryContext(ctx, query, *collection.ParentID)
+		if err != nil {
+			return err
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		// Run again now that the locks are held, the first statement may have
+		// read the tree as it was before a concurrent move committed.
+		query = collectionAncestors + `
+			SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)`
+		var cycle bool
+		err = tx.QueryRowContext(ctx, query, *collection.ParentID, collection.ID).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return ErrCollectionCycle
+		}
+	}
+
+	query := `
+		UPDATE collections
+		SET name = $1, description = $2, parent_id = $3, position = $4, version = version + 1
+		WHERE id = $5 AND version = $6
+		RETURNING version`
+	args := []interface{}{
+		collection.Name,
+		collection.Description,
+		collection.ParentID,
+		collection.Position,
+		collection.ID,
+		collection.Version,
+	}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&collection.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+		return err
+	}
+
+	if collection.Name != name {
+		if err = touchCollectionMovies(ctx, tx, collection.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Delete removes a collection. Its sub-collections move up to the top level.
+func (m CollectionModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = touchCollectionMovies(ctx, tx, id); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM collections WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return tx.Commit()
+}
+
+// SetMovies replaces the membership of a collection with movieIds, in order.
+// Trashed members are not listed anywhere, so they keep their place and come
+// back with the movie when it is restored.
+func (m CollectionModel) SetMovies(collectionId int64, movieIds []int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `SELECT id FROM collections WHERE id = $1 FOR UPDATE`, collectionId).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	query := `
+		DELETE FROM collection_movies
+		WHERE collection_id = $1
+		AND movie_id IN (SELECT id FROM movies WHERE deleted_at IS NULL)
+		RETURNING movie_id`
+	rows, err := tx.QueryContext(ctx, query, collectionId)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	removed := []int64{}
+	for rows.Next() {
+		var movieId int64
+		if err = rows.Scan(&movieId); err != nil {
+			return err
+		}
+		removed = append(removed, movieId)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO collection_movies (collection_id, movie_id, position)
+		SELECT $1, ordered.movie_id, ordered.position
+		FROM unnest($2::bigint[]) WITH ORDINALITY AS ordered(movie_id, position)
+		INNER JOIN movies ON movies.id = ordered.movie_id AND movies.deleted_at IS NULL`
+	result, err := tx.ExecContext(ctx, query, collectionId, movieIds)
+	if err != nil {
+		return err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted != int64(len(movieIds)) {
+		return ErrRecordNotFound
+	}
+
+	// Every movie joining, leaving or changing place shows the collection
+	// differently now.
+	_, err = touchMovies(ctx, tx, `(id = ANY ($1::bigint[]) OR id = ANY ($2::bigint[]))`, removed, movieIds)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
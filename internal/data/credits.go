@@ -0,0 +1,162 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"time"
+)
+
+const (
+	CreditRoleDirector = "director"
+	CreditRoleActor    = "actor"
+)
+
+var ErrDuplicateCredit = errors.New("duplicate credit")
+
+type Credit struct {
+	ID           int64  `json:"id"`
+	MovieID      int64  `json:"movieId"`
+	PersonID     int64  `json:"personId"`
+	PersonName   string `json:"personName"`
+	Role         string `json:"role"`
+	Character    string `json:"character,omitempty"`
+	BillingOrder int32  `json:"billingOrder"`
+}
+
+type CreditRepository interface {
+	Insert(credit *Credit) error
+	GetAllForMovie(movieId int64) ([]*Credit, error)
+	GetAllForPerson(personId int64) ([]*Credit, error)
+	Delete(movieId int64, creditId int64) error
+}
+
+type CreditModel struct {
+	DB *sql.DB
+}
+
+func (m CreditModel) Insert(credit *Credit) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = touchMovie(ctx, tx, credit.MovieID); err != nil {
+		return err
+	}
+
+	query := `
+		WITH inserted AS (
+			INSERT INTO credits (movie_id, person_id, role, character, billing_order)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, person_id
+		)
+		SELECT inserted.id, people.name FROM inserted
+		INNER JOIN people ON people.id = inserted.person_id`
+	args := []interface{}{credit.MovieID, credit.PersonID, credit.Role, credit.Character, credit.BillingOrder}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&credit.ID, &credit.PersonName)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		case errors.As(err, &pgErr) && pgErr.Code == "23503":
+			return ErrRecordNotFound
+		case errors.As(err, &pgErr) && pgErr.Code == "23505":
+			return ErrDuplicateCredit
+		default:
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (m CreditModel) GetAllForMovie(movieId int64) ([]*Credit, error) {
+	query := `
+		SELECT credits.id, credits.movie_id, credits.person_id, people.name, credits.role, credits.character,
+		       credits.billing_order
+		FROM credits
+		INNER JOIN people ON people.id = credits.person_id
+		WHERE credits.movie_id = $1
+		ORDER BY credits.role, credits.billing_order, credits.id`
+	return m.list(query, movieId)
+}
+
+func (m CreditModel) GetAllForPerson(personId int64) ([]*Credit, error) {
+	query := `
+		SELECT credits.id, credits.movie_id, credits.person_id, people.name, credits.role, credits.character,
+		       credits.billing_order
+		FROM credits
+		INNER JOIN people ON people.id = credits.person_id
+		INNER JOIN movies ON movies.id = credits.movie_id
+		WHERE credits.person_id = $1 AND movies.deleted_at IS NULL
+		ORDER BY movies.year, credits.id`
+	return m.list(query, personId)
+}
+
+func (m CreditModel) list(query string, id int64) ([]*Credit, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []*Credit{}
+	for rows.Next() {
+		var credit Credit
+		err := rows.Scan(
+			&credit.ID,
+			&credit.MovieID,
+			&credit.PersonID,
+			&credit.PersonName,
+			&credit.Role,
+			&credit.Character,
+			&credit.BillingOrder,
+		)
+		if err != nil {
+			return nil, err
+		}
+		credits = append(credits, &credit)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return credits, nil
+}
+
+func (m CreditModel) Delete(movieId int64, creditId int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM credits WHERE id = $1 AND movie_id = $2`
+	result, err := tx.ExecContext(ctx, query, creditId, movieId)
+	if err != nil {
+		return err
+	}
+	rowAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	// Credits of trashed movies are not shown anywhere, so there is nothing
+	// to move on for them.
+	err = touchMovie(ctx, tx, movieId)
+	if err != nil && !errors.Is(err, ErrRecordNotFound) {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,49 @@
+package data
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+var ErrInvalidDateFormat = errors.New("invalid date format")
+
+// Date is a calendar date without time of day, written as YYYY-MM-DD in JSON
+// and stored in a Postgres date column.
+type Date struct {
+	time.Time
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(d.Format(dateLayout))), nil
+}
+
+func (d *Date) UnmarshalJSON(jsonValue []byte) error {
+	unquote, err := strconv.Unquote(string(jsonValue))
+	if err != nil {
+		return ErrInvalidDateFormat
+	}
+	t, err := time.Parse(dateLayout, unquote)
+	if err != nil {
+		return ErrInvalidDateFormat
+	}
+	d.Time = t
+	return nil
+}
+
+func (d *Date) Scan(src any) error {
+	t, ok := src.(time.Time)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into Date", src)
+	}
+	d.Time = t
+	return nil
+}
+
+func (d Date) Value() (driver.Value, error) {
+	return d.Format(dateLayout), nil
+}
@@ -0,0 +1,245 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgtype"
+	"time"
+)
+
+var ErrMergeIntoSelf = errors.New("cannot merge a movie into itself")
+
+// duplicateTitleSimilarity is the trigram similarity two normalised titles
+// need to be reported as duplicates. It is stricter than the default
+// threshold of the % operator, which only narrows the search down through
+// the trigram index.
+const duplicateTitleSimilarity = 0.6
+
+type DuplicateMovie struct {
+	ID          int64  `json:"id"`
+	Title       string `json:"title"`
+	RatingCount int32  `json:"ratingCount"`
+}
+
+// DuplicateCandidate pairs two live movies that look like the same film. The
+// newer one is the natural candidate to merge into the original.
+type DuplicateCandidate struct {
+	Year         int32          `json:"year"`
+	Similarity   float64        `json:"similarity"`
+	Original     DuplicateMovie `json:"original"`
+	Duplicate    DuplicateMovie `json:"duplicate"`
+	SharedGenres []string       `json:"sharedGenres"`
+}
+
+func NewDuplicateFilters() Filters {
+	return Filters{
+		Page:         1,
+		PageSize:     20,
+		Sort:         "-year",
+		SortSafelist: []string{"year", "-year", "similarity", "-similarity", "original_id", "-original_id", "duplicate_id", "-duplicate_id"},
+	}
+}
+
+// GetDuplicateCandidates reports pairs of live movies released the same year
+// with similar normalised titles and at least one genre in common.
+func (m MovieModel) GetDuplicateCandidates(filters Filters) ([]*DuplicateCandidate, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), year, similarity, original_id, original_title, original_ratings,
+		       duplicate_id, duplicate_title, duplicate_ratings, shared_genres
+		FROM (
+			SELECT a.year, similarity(a.normalized_title, b.normalized_title) AS similarity,
+			       a.id AS original_id, a.title AS original_title, a.rating_count AS original_ratings,
+			       b.id AS duplicate_id, b.title AS duplicate_title, b.rating_count AS duplicate_ratings,
+			       ARRAY(SELECT unnest(a.genres) INTERSECT SELECT unnest(b.genres) ORDER BY 1) AS shared_genres
+			FROM movies a
+			INNER JOIN movies b ON b.normalized_title %% a.normalized_title AND b.year = a.year AND b.id > a.id
+			WHERE a.deleted_at IS NULL AND b.deleted_at IS NULL
+			AND a.genres && b.genres
+		) candidates
+		WHERE similarity >= $3
+		ORDER BY %s, original_id, duplicate_id
+		LIMIT $1 OFFSET $2`, filters.getOrderBySpec())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset(), duplicateTitleSimilarity)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	candidates := []*DuplicateCandidate{}
+	pgMap := pgtype.NewMap()
+	for rows.Next() {
+		var candidate DuplicateCandidate
+		err := rows.Scan(
+			&totalRecords,
+			&candidate.Year,
+			&candidate.Similarity,
+			&candidate.Original.ID,
+			&candidate.Original.Title,
+			&candidate.Original.RatingCount,
+			&candidate.Duplicate.ID,
+			&candidate.Duplicate.Title,
+			&candidate.Duplicate.RatingCount,
+			pgMap.SQLScanner(&candidate.SharedGenres),
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		candidates = append(candidates, &candidate)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return candidates, calculateMetadata(filters.Page, filters.PageSize, totalRecords), nil
+}
+
+// mergeStatements move the rows hanging off movie $1 over to movie $2. Rows
+// that would collide with one the target already has are left behind and
+// go away with the merged movie, so the target's own data always wins.
+var mergeStatements = []string{
+	`UPDATE ratings SET movie_id = $2 WHERE movie_id = $1
+		AND user_id NOT IN (SELECT user_id FROM ratings WHERE movie_id = $2)`,
+	`UPDATE reviews SET movie_id = $2 WHERE movie_id = $1`,
+	`UPDATE list_items SET movie_id = $2 WHERE movie_id = $1
+		AND list_id NOT IN (SELECT list_id FROM list_items WHERE movie_id = $2)`,
+	`UPDATE credits SET movie_id = $2 WHERE movie_id = $1
+		AND NOT EXISTS (
+			SELECT 1 FROM credits target WHERE target.movie_id = $2 AND target.person_id = credits.person_id
+			AND target.role = credits.role AND target.character = credits.character)`,
+	`UPDATE collection_movies SET movie_id = $2 WHERE movie_id = $1
+		AND collection_id NOT IN (SELECT collection_id FROM collection_movies WHERE movie_id = $2)`,
+	`UPDATE movie_external_ids SET movie_id = $2 WHERE movie_id = $1
+		AND source NOT IN (SELECT source FROM movie_external_ids WHERE movie_id = $2)`,
+	// Titles move one by one, and a display title becomes an alternate one
+	// where the target already shows a title in that locale.
+	`UPDATE movie_titles SET movie_id = $2,
+		alternate = alternate OR EXISTS (
+			SELECT 1 FROM movie_titles target WHERE target.movie_id = $2
+			AND target.locale = movie_titles.locale AND NOT target.alternate)
+		WHERE movie_id = $1
+		AND NOT EXISTS (
+			SELECT 1 FROM movie_titles target WHERE target.movie_id = $2
+			AND target.locale = movie_titles.locale AND target.title = movie_titles.title)`,
+	`UPDATE movie_translations SET movie_id = $2 WHERE movie_id = $1
+		AND locale NOT IN (SELECT locale FROM movie_translations WHERE movie_id = $2)`,
+	`UPDATE movie_images SET movie_id = $2 WHERE movie_id = $1`,
+	`INSERT INTO movie_stats (movie_id, bucket, views, search_hits)
+		SELECT $2, bucket, views, search_hits FROM movie_stats WHERE movie_id = $1
+		ON CONFLICT (movie_id, bucket) DO UPDATE
+		SET views = movie_stats.views + EXCLUDED.views, search_hits = movie_stats.search_hits + EXCLUDED.search_hits`,
+	`UPDATE movie_redirects SET movie_id = $2 WHERE movie_id = $1`,
+}
+
+// Merge folds the movie id into the live movie targetId. Dependent rows move
+// to the target, the merged movie is removed and its id redirects to the
+// target from then on. The merged movie may already be in the trash.
+func (m MovieModel) Merge(id int64, targetId int64, userId int64) (*Movie, error) {
+	if id < 1 || targetId < 1 {
+		return nil, ErrRecordNotFound
+	}
+	if id == targetId {
+		return nil, ErrMergeIntoSelf
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock in id order so two merges touching the same pair cannot deadlock.
+	first, second := id, targetId
+	if first > second {
+		first, second = second, first
+	}
+	locked := map[int64]*Movie{}
+	for _, movieId := range []int64{first, second} {
+		locked[movieId], err = m.getForUpdate(ctx, tx, movieId)
+		if err != nil {
+			return nil, err
+		}
+	}
+	source, before := locked[id], locked[targetId]
+	if before.DeletedAt != nil {
+		return nil, ErrRecordNotFound
+	}
+
+	for _, statement := range mergeStatements {
+		_, err = tx.ExecContext(ctx, statement, id, targetId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM movies WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO movie_redirects (old_id, movie_id) VALUES ($1, $2)`, id, targetId)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = refreshRatingSummary(ctx, tx, targetId)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE movies SET version = version + 1, updated_at = NOW() WHERE id = $1`, targetId)
+	if err != nil {
+		return nil, err
+	}
+	// Reloaded so the revision and event carry what moved over, such as
+	// external ids.
+	after, err := m.getForUpdate(ctx, tx, targetId)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := *source
+	merged.Version++
+	err = recordRevision(ctx, tx, RevisionActionMerge, userId, source, &merged)
+	if err != nil {
+		return nil, err
+	}
+	err = recordEvent(ctx, tx, EventMovieDeleted, &merged)
+	if err != nil {
+		return nil, err
+	}
+	err = recordRevision(ctx, tx, RevisionActionMerge, userId, before, after)
+	if err != nil {
+		return nil, err
+	}
+	err = recordEvent(ctx, tx, EventMovieUpdated, after)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+// GetRedirect returns the id of the movie that the merged movie id now lives
+// on as.
+func (m MovieModel) GetRedirect(id int64) (int64, error) {
+	query := `SELECT movie_id FROM movie_redirects WHERE old_id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var movieId int64
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&movieId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrRecordNotFound
+		}
+		return 0, err
+	}
+	return movieId, nil
+}
@@ -0,0 +1,199 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/stdlib"
+	"strconv"
+	"time"
+)
+
+// eventsChannel is the NOTIFY channel announcing new outbox rows by id.
+const eventsChannel = "movie_events"
+
+const (
+	EventMovieCreated = "movie.created"
+	EventMovieUpdated = "movie.updated"
+	EventMovieDeleted = "movie.deleted"
+	EventMoviePurged  = "movie.purged"
+)
+
+var EventTypes = []string{EventMovieCreated, EventMovieUpdated, EventMovieDeleted, EventMoviePurged}
+
+type MovieEvent struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	MovieID   int64           `json:"movieId"`
+	Payload   json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"createdAt"`
+	// Horizon is the oldest transaction still running when the event was
+	// read. Events of that transaction or later ones may yet commit with
+	// lower ids.
+	Horizon int64 `json:"-"`
+}
+
+// eventColumns reads events along with the current transaction horizon.
+const eventColumns = `id, type, movie_id, payload, created_at, pg_snapshot_xmin(pg_current_snapshot())::text::bigint`
+
+// recordEvent appends a catalogue event to the outbox inside tx, queues a
+// delivery for every active webhook subscribed to it and notifies listeners,
+// so nothing is sent for changes that roll back and nothing is lost for
+// those that commit.
+func recordEvent(ctx context.Context, tx *sql.Tx, eventType string, movie *Movie) error {
+	payload, err := json.Marshal(map[string]*Movie{"movie": movie})
+	if err != nil {
+		return err
+	}
+
+	var eventId int64
+	query := `INSERT INTO movie_events (type, movie_id, payload) VALUES ($1, $2, $3) RETURNING id`
+	err = tx.QueryRowContext(ctx, query, eventType, movie.ID, payload).Scan(&eventId)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO webhook_deliveries (webhook_id, event_id)
+		SELECT id, $1 FROM webhooks WHERE active AND $2 = ANY(events)`
+	_, err = tx.ExecContext(ctx, query, eventId, eventType)
+	if err != nil {
+		return err
+	}
+
+	// Postgres holds the notification back until the transaction commits.
+	_, err = tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`, eventsChannel, strconv.FormatInt(eventId, 10))
+	return err
+}
+
+type MovieEventRepository interface {
+	GetByIds(ids []int64) ([]*MovieEvent, error)
+	GetAfter(id int64, limit int) ([]*MovieEvent, error)
+	GetInFlight(afterId int64, beforeId int64, horizon int64, limit int) ([]*MovieEvent, error)
+	Exists(id int64) (bool, error)
+	Prune(retention time.Duration) (int64, error)
+	Listen(ctx context.Context, fn func(eventId int64)) error
+}
+
+type MovieEventModel struct {
+	DB *sql.DB
+}
+
+func (m MovieEventModel) query(query string, args ...any) ([]*MovieEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*MovieEvent{}
+	for rows.Next() {
+		var event MovieEvent
+		var payload []byte
+		err = rows.Scan(&event.ID, &event.Type, &event.MovieID, &payload, &event.CreatedAt, &event.Horizon)
+		if err != nil {
+			return nil, err
+		}
+		event.Payload = json.RawMessage(payload)
+		events = append(events, &event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (m MovieEventModel) GetByIds(ids []int64) ([]*MovieEvent, error) {
+	return m.query(`
+		SELECT `+eventColumns+` FROM movie_events
+		WHERE id = ANY($1)
+		ORDER BY id`, ids)
+}
+
+// GetAfter returns up to limit events logged after id, oldest first.
+func (m MovieEventModel) GetAfter(id int64, limit int) ([]*MovieEvent, error) {
+	return m.query(`
+		SELECT `+eventColumns+` FROM movie_events
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2`, id, limit)
+}
+
+// GetInFlight returns up to limit events with ids between afterId and
+// beforeId that were logged by transactions at or past horizon. Those may
+// have committed only after an event with a higher id was read.
+func (m MovieEventModel) GetInFlight(afterId int64, beforeId int64, horizon int64, limit int) ([]*MovieEvent, error) {
+	return m.query(`
+		SELECT `+eventColumns+` FROM movie_events
+		WHERE id > $1 AND id < $2 AND txid >= $3
+		ORDER BY id
+		LIMIT $4`, afterId, beforeId, horizon, limit)
+}
+
+// Exists reports whether event id is still in the log, telling a client
+// resuming from it apart from one whose position has been pruned away.
+func (m MovieEventModel) Exists(id int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists bool
+	err := m.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM movie_events WHERE id = $1)`, id).Scan(&exists)
+	return exists, err
+}
+
+// Prune drops events older than retention, keeping those that still have
+// webhook deliveries waiting to go out.
+func (m MovieEventModel) Prune(retention time.Duration) (int64, error) {
+	query := `
+		DELETE FROM movie_events
+		WHERE created_at < $1
+		AND NOT EXISTS (
+			SELECT 1 FROM webhook_deliveries
+			WHERE webhook_deliveries.event_id = movie_events.id AND status IN ('pending', 'failed'))`
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Listen calls fn with the id of every event committed from now on, by any
+// instance, until ctx is cancelled or the connection fails. It holds a
+// connection of its own for the whole time.
+func (m MovieEventModel) Listen(ctx context.Context, fn func(eventId int64)) error {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		pgxConn := driverConn.(*stdlib.Conn).Conn()
+		_, err := pgxConn.Exec(ctx, "LISTEN "+eventsChannel)
+		if err != nil {
+			return err
+		}
+		for {
+			notification, err := pgxConn.WaitForNotification(ctx)
+			if err != nil {
+				// The connection is still subscribed, or broken, so it must
+				// not go back to the pool.
+				return fmt.Errorf("%w: %w", driver.ErrBadConn, err)
+			}
+			eventId, err := strconv.ParseInt(notification.Payload, 10, 64)
+			if err != nil {
+				return errors.New("malformed movie event notification: " + notification.Payload)
+			}
+			fn(eventId)
+		}
+	})
+}
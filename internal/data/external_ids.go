@@ -0,0 +1,80 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"time"
+)
+
+var ErrDuplicateExternalID = errors.New("duplicate external id")
+
+// saveExternalIDs replaces the external identifiers of a movie with ids.
+func saveExternalIDs(ctx context.Context, tx *sql.Tx, movieId int64, ids map[string]string) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM movie_external_ids WHERE movie_id = $1`, movieId)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO movie_external_ids (source, external_id, movie_id) VALUES ($1, $2, $3)`
+	for source, externalId := range ids {
+		_, err = tx.ExecContext(ctx, query, source, externalId, movieId)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+				return ErrDuplicateExternalID
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func getExternalIDs(ctx context.Context, q queryer, movieId int64) (map[string]string, error) {
+	rows, err := q.QueryContext(ctx, `SELECT source, external_id FROM movie_external_ids WHERE movie_id = $1`, movieId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := map[string]string{}
+	for rows.Next() {
+		var source, externalId string
+		if err = rows.Scan(&source, &externalId); err != nil {
+			return nil, err
+		}
+		ids[source] = externalId
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// GetIdByExternalID resolves an identifier from an outside catalogue to the id
+// of the live movie it is mapped to.
+func (m MovieModel) GetIdByExternalID(source string, externalId string) (int64, error) {
+	query := `
+		SELECT movies.id FROM movie_external_ids
+		INNER JOIN movies ON movies.id = movie_external_ids.movie_id
+		WHERE movie_external_ids.source = $1 AND movie_external_ids.external_id = $2
+		AND movies.deleted_at IS NULL`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+	err := m.DB.QueryRowContext(ctx, query, source, externalId).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrRecordNotFound
+		}
+		return 0, err
+	}
+	return id, nil
+}
@@ -2,20 +2,42 @@ package data
 
 import (
 	"fmt"
+	"github.com/go-playground/validator/v10"
 	"math"
+	"slices"
 	"strings"
 )
 
 type Filters struct {
-	Page     int    `schema:"page" validate:"min=1"`
-	PageSize int    `schema:"pageSize" validate:"max=1000000"`
-	Sort     string `schema:"sort" validate:"oneof=id -id title -title runtime -runtime year -year"`
+	Page         int      `schema:"page" validate:"min=1"`
+	PageSize     int      `schema:"pageSize" validate:"max=1000000"`
+	Sort         string   `schema:"sort"`
+	SortSafelist []string `schema:"-" validate:"-"`
 }
 
+// FiltersStructLevelValidation rejects any Sort value missing from the
+// SortSafelist, because the sort column is interpolated into ORDER BY.
+func FiltersStructLevelValidation(sl validator.StructLevel) {
+	f := sl.Current().Interface().(Filters)
+	if !slices.Contains(f.SortSafelist, f.Sort) {
+		sl.ReportError(f.Sort, "Sort", "Sort", "oneof", strings.Join(f.SortSafelist, " "))
+	}
+}
+
+// getOrderBySpec builds the ORDER BY clause for Sort. A value missing from
+// the SortSafelist never reaches the query; the first safelisted sort is used
+// instead.
 func (f Filters) getOrderBySpec() string {
-	field := strings.TrimPrefix(f.Sort, "-")
+	sort := f.Sort
+	if !slices.Contains(f.SortSafelist, sort) {
+		sort = "id"
+		if len(f.SortSafelist) > 0 {
+			sort = f.SortSafelist[0]
+		}
+	}
+	field := strings.TrimPrefix(sort, "-")
 	order := "ASC"
-	if strings.HasPrefix(f.Sort, "-") {
+	if strings.HasPrefix(sort, "-") {
 		order = "DESC"
 	}
 	return fmt.Sprintf("%s %s", field, order)
@@ -28,8 +50,11 @@ func (f Filters) offset() int {
 }
 
 type MovieFilters struct {
-	Title  string   `schema:"title"`
-	Genres []string `schema:"genres"`
+	Title      string   `schema:"title"`
+	Genres     []string `schema:"genres"`
+	Person     int64    `schema:"person" validate:"min=0"`
+	Director   int64    `schema:"director" validate:"min=0"`
+	Collection int64    `schema:"collection" validate:"min=0"`
 	Filters
 }
 
@@ -38,9 +63,10 @@ func NewMovieFilters() MovieFilters {
 		Title:  "",
 		Genres: []string{},
 		Filters: Filters{
-			Page:     1,
-			PageSize: 20,
-			Sort:     "id",
+			Page:         1,
+			PageSize:     20,
+			Sort:         "id",
+			SortSafelist: []string{"id", "-id", "title", "-title", "runtime", "-runtime", "year", "-year", "rating", "-rating"},
 		},
 	}
 }
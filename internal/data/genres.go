@@ -0,0 +1,350 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDuplicateGenre = errors.New("duplicate genre")
+	ErrDuplicateAlias = errors.New("duplicate genre alias")
+	ErrGenreInUse     = errors.New("genre in use")
+)
+
+var slugUnsafe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Slugify turns a display name into the canonical slug form used for genres,
+// matching the normalisation done by the genres migration.
+func Slugify(name string) string {
+	return strings.Trim(slugUnsafe.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+type Genre struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	Aliases   []string  `json:"aliases"`
+	Version   int32     `json:"version,omitempty"`
+}
+
+type GenreRepository interface {
+	Insert(genre *Genre) error
+	GetAll() ([]*Genre, error)
+	GetBySlug(slug string) (*Genre, error)
+	Update(genre *Genre) error
+	Delete(slug string) error
+	Merge(from string, into string, userId int64) error
+	Resolve(names []string) (map[string]string, error)
+	ResolveFilter(genres []string) error
+}
+
+type GenreModel struct {
+	DB *sql.DB
+}
+
+func normaliseAliases(aliases []string) []string {
+	out := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		alias = strings.ToLower(strings.TrimSpace(alias))
+		if alias != "" && !slices.Contains(out, alias) {
+			out = append(out, alias)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// genreColumns selects a genre with its aliases, which live in genre_aliases
+// so that an alias can only ever name one genre.
+const genreColumns = `id, created_at, slug, name,
+		ARRAY(SELECT alias FROM genre_aliases WHERE genre_id = genres.id ORDER BY alias), version`
+
+// saveAliases replaces the aliases of a genre inside tx.
+func saveAliases(ctx context.Context, tx *sql.Tx, genreId int64, aliases []string) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM genre_aliases WHERE genre_id = $1`, genreId)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO genre_aliases (alias, genre_id) SELECT unnest($2::text[]), $1`
+	_, err = tx.ExecContext(ctx, query, genreId, aliases)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrDuplicateAlias
+		}
+		return err
+	}
+	return nil
+}
+
+func (m GenreModel) Insert(genre *Genre) error {
+	genre.Aliases = normaliseAliases(genre.Aliases)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO genres (slug, name) VALUES ($1, $2)
+			RETURNING id, created_at, version`
+	err = tx.QueryRowContext(ctx, query, genre.Slug, genre.Name).Scan(&genre.ID, &genre.CreatedAt, &genre.Version)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrDuplicateGenre
+		}
+		return err
+	}
+
+	if err = saveAliases(ctx, tx, genre.ID, genre.Aliases); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m GenreModel) GetAll() ([]*Genre, error) {
+	query := `SELECT ` + genreColumns + ` FROM genres ORDER BY name`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pgMap := pgtype.NewMap()
+	genres := []*Genre{}
+	for rows.Next() {
+		var genre Genre
+		err := rows.Scan(
+			&genre.ID,
+			&genre.CreatedAt,
+			&genre.Slug,
+			&genre.Name,
+			pgMap.SQLScanner(&genre.Aliases),
+			&genre.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		genres = append(genres, &genre)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return genres, nil
+}
+
+func (m GenreModel) GetBySlug(slug string) (*Genre, error) {
+	query := `SELECT ` + genreColumns + ` FROM genres WHERE slug = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pgMap := pgtype.NewMap()
+	var genre Genre
+	err := m.DB.QueryRowContext(ctx, query, slug).Scan(
+		&genre.ID,
+		&genre.CreatedAt,
+		&genre.Slug,
+		&genre.Name,
+		pgMap.SQLScanner(&genre.Aliases),
+		&genre.Version,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &genre, nil
+}
+
+// Update changes the display name and aliases of a genre. Slugs are stored in
+// movies.genres, so renaming one goes through Merge instead.
+func (m GenreModel) Update(genre *Genre) error {
+	genre.Aliases = normaliseAliases(genre.Aliases)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE genres
+		SET name = $1, version = version + 1
+		WHERE id = $2 AND version = $3
+		RETURNING version`
+	err = tx.QueryRowContext(ctx, query, genre.Name, genre.ID, genre.Version).Scan(&genre.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+		return err
+	}
+
+	if err = saveAliases(ctx, tx, genre.ID, genre.Aliases); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete removes a genre no movie refers to anymore, trashed ones included.
+func (m GenreModel) Delete(slug string) error {
+	query := `
+		DELETE FROM genres
+		WHERE slug = $1 AND NOT EXISTS (SELECT 1 FROM movies WHERE genres @> ARRAY[$1])`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, slug)
+	if err != nil {
+		return err
+	}
+	rowAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowAffected == 0 {
+		_, err = m.GetBySlug(slug)
+		if err != nil {
+			return err
+		}
+		return ErrGenreInUse
+	}
+	return nil
+}
+
+// Merge folds genre from into genre into: the old slug, name and aliases
+// become aliases of into, from is removed and every movie tagged with it,
+// trashed ones included, is retagged through the usual versioned update, so
+// each of them gets a revision and an event.
+func (m GenreModel) Merge(from string, into string, userId int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var fromId, intoId int64
+	var fromName string
+	err = tx.QueryRowContext(ctx, `SELECT id, name FROM genres WHERE slug = $1 FOR UPDATE`, from).Scan(&fromId, &fromName)
+	if err == nil {
+		err = tx.QueryRowContext(ctx, `SELECT id FROM genres WHERE slug = $1 FOR UPDATE`, into).Scan(&intoId)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE genre_aliases SET genre_id = $2 WHERE genre_id = $1`, fromId, intoId)
+	if err != nil {
+		return err
+	}
+	// An alias some other genre already claims stays with that genre.
+	query := `
+		INSERT INTO genre_aliases (alias, genre_id) SELECT unnest($2::text[]), $1
+		ON CONFLICT (alias) DO NOTHING`
+	_, err = tx.ExecContext(ctx, query, intoId, normaliseAliases([]string{from, fromName}))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE genres SET version = version + 1 WHERE id = $1`, intoId)
+	if err != nil {
+		return err
+	}
+
+	movies, err := queryMovies(ctx, tx, `WHERE genres @> ARRAY[$1] ORDER BY id FOR UPDATE`, from)
+	if err != nil {
+		return err
+	}
+	for _, before := range movies {
+		movie := *before
+		movie.Genres = make([]string, 0, len(before.Genres))
+		for _, genre := range before.Genres {
+			if genre == from {
+				genre = into
+			}
+			if !slices.Contains(movie.Genres, genre) {
+				movie.Genres = append(movie.Genres, genre)
+			}
+		}
+		if err = updateMovie(ctx, tx, before, &movie, userId); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM genres WHERE id = $1`, fromId)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Resolve maps each of names to the slug of the genre it names, matching slugs,
+// display names and aliases case-insensitively. Unknown names are left out of
+// the result.
+func (m GenreModel) Resolve(names []string) (map[string]string, error) {
+	query := `
+		SELECT input.name, genres.slug
+		FROM unnest($1::text[]) AS input(name)
+		INNER JOIN genres ON lower(input.name) = genres.slug
+			OR lower(input.name) = lower(genres.name)
+			OR EXISTS (SELECT 1 FROM genre_aliases
+			           WHERE genre_aliases.genre_id = genres.id AND genre_aliases.alias = lower(input.name))`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, names)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resolved := make(map[string]string, len(names))
+	for rows.Next() {
+		var name, slug string
+		if err = rows.Scan(&name, &slug); err != nil {
+			return nil, err
+		}
+		resolved[name] = slug
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
+
+// ResolveFilter rewrites the genre names of a movie filter to their slugs in
+// place. Unknown names are kept, they simply match no movie.
+func (m GenreModel) ResolveFilter(genres []string) error {
+	if len(genres) == 0 {
+		return nil
+	}
+	resolved, err := m.Resolve(genres)
+	if err != nil {
+		return err
+	}
+	for i, genre := range genres {
+		if slug, ok := resolved[genre]; ok {
+			genres[i] = slug
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	ImageKindPoster   = "poster"
+	ImageKindBackdrop = "backdrop"
+	ImageKindStill    = "still"
+
+	// ImageOriginal names the file holding the upload exactly as received.
+	ImageOriginal = "original"
+)
+
+type MovieImage struct {
+	ID          int64             `json:"id"`
+	MovieID     int64             `json:"movieId"`
+	Kind        string            `json:"kind"`
+	ContentType string            `json:"contentType"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	Size        int64             `json:"size"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	URLs        map[string]string `json:"urls,omitempty"`
+}
+
+// Key returns the storage key of one variant of the image. Resized variants
+// are always JPEG, the original keeps its uploaded format.
+func (i *MovieImage) Key(variant string) string {
+	ext := "jpg"
+	if variant == ImageOriginal {
+		switch i.ContentType {
+		case "image/png":
+			ext = "png"
+		case "image/gif":
+			ext = "gif"
+		}
+	}
+	return fmt.Sprintf("images/%d/%s.%s", i.ID, variant, ext)
+}
+
+type MovieImageRepository interface {
+	Insert(image *MovieImage) error
+	GetById(id int64) (*MovieImage, error)
+	GetAllForMovie(movieId int64) ([]*MovieImage, error)
+	GetForMovies(movieIds []int64) (map[int64][]*MovieImage, error)
+	Delete(movieId int64, id int64) (*MovieImage, error)
+	DeleteDetached(fn func(*MovieImage) error) (int64, error)
+}
+
+type MovieImageModel struct {
+	DB *sql.DB
+}
+
+const movieImageColumns = `id, COALESCE(movie_id, 0), kind, content_type, width, height, size, created_at`
+
+func scanMovieImage(row scanner, image *MovieImage) error {
+	return row.Scan(
+		&image.ID,
+		&image.MovieID,
+		&image.Kind,
+		&image.ContentType,
+		&image.Width,
+		&image.Height,
+		&image.Size,
+		&image.CreatedAt,
+	)
+}
+
+// Insert records a new image of a live movie, which moves the movie on to a
+// new version.
+func (m MovieImageModel) Insert(image *MovieImage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = touchMovie(ctx, tx, image.MovieID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO movie_images (movie_id, kind, content_type, width, height, size)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+	args := []interface{}{image.MovieID, image.Kind, image.ContentType, image.Width, image.Height, image.Size}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&image.ID, &image.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetById returns an image of a live movie. Images of trashed or purged
+// movies are reported as not found.
+func (m MovieImageModel) GetById(id int64) (*MovieImage, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `SELECT ` + movieImageColumns + ` FROM movie_images
+		WHERE id = $1
+		AND EXISTS (SELECT 1 FROM movies WHERE movies.id = movie_images.movie_id AND movies.deleted_at IS NULL)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var image MovieImage
+	err := scanMovieImage(m.DB.QueryRowContext(ctx, query, id), &image)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &image, nil
+}
+
+func (m MovieImageModel) GetAllForMovie(movieId int64) ([]*MovieImage, error) {
+	images, err := m.GetForMovies([]int64{movieId})
+	if err != nil {
+		return nil, err
+	}
+	if images[movieId] == nil {
+		return []*MovieImage{}, nil
+	}
+	return images[movieId], nil
+}
+
+// GetForMovies loads the images of several movies at once, keyed by movie id.
+func (m MovieImageModel) GetForMovies(movieIds []int64) (map[int64][]*MovieImage, error) {
+	images := map[int64][]*MovieImage{}
+	if len(movieIds) == 0 {
+		return images, nil
+	}
+	query := `SELECT ` + movieImageColumns + ` FROM movie_images
+		WHERE movie_id = ANY($1)
+		ORDER BY movie_id, kind, id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var image MovieImage
+		if err = scanMovieImage(rows, &image); err != nil {
+			return nil, err
+		}
+		images[image.MovieID] = append(images[image.MovieID], &image)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// Delete removes the image record of a live movie and returns it, so the
+// caller can remove the stored files. The movie moves on to a new version.
+func (m MovieImageModel) Delete(movieId int64, id int64) (*MovieImage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = touchMovie(ctx, tx, movieId); err != nil {
+		return nil, err
+	}
+
+	query := `DELETE FROM movie_images WHERE id = $1 AND movie_id = $2 RETURNING ` + movieImageColumns
+	var image MovieImage
+	err = scanMovieImage(tx.QueryRowContext(ctx, query, id, movieId), &image)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
+
+// DeleteDetached hands every image whose movie has been purged to fn and
+// drops its record once fn succeeds. It reports how many were removed.
+func (m MovieImageModel) DeleteDetached(fn func(*MovieImage) error) (int64, error) {
+	query := `SELECT ` + movieImageColumns + ` FROM movie_images WHERE movie_id IS NULL LIMIT 500`
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	images := []*MovieImage{}
+	for rows.Next() {
+		var image MovieImage
+		if err = scanMovieImage(rows, &image); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		images = append(images, &image)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var removed int64
+	for _, image := range images {
+		if err = fn(image); err != nil {
+			return removed, err
+		}
+		_, err = m.DB.ExecContext(ctx, `DELETE FROM movie_images WHERE id = $1`, image.ID)
+		if err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
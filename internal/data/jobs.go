@@ -0,0 +1,289 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusFailed    = "failed"
+	JobStatusSucceeded = "succeeded"
+	JobStatusDead      = "dead"
+)
+
+var ErrJobNotRetryable = errors.New("job not retryable")
+
+type Job struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int32           `json:"attempts"`
+	MaxAttempts int32           `json:"maxAttempts"`
+	RunAt       time.Time       `json:"runAt"`
+	LockedUntil *time.Time      `json:"lockedUntil"`
+	LastError   string          `json:"lastError"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	FinishedAt  *time.Time      `json:"finishedAt"`
+	// LeaseToken identifies the claim a job was picked up under.
+	LeaseToken string `json:"-"`
+}
+
+type JobFilters struct {
+	Status string `schema:"status" validate:"omitempty,oneof=pending running failed succeeded dead"`
+	Kind   string `schema:"kind" validate:"max=100"`
+	Filters
+}
+
+func NewJobFilters() JobFilters {
+	return JobFilters{
+		Filters: Filters{
+			Page:         1,
+			PageSize:     20,
+			Sort:         "-id",
+			SortSafelist: []string{"id", "-id", "run_at", "-run_at"},
+		},
+	}
+}
+
+type JobRepository interface {
+	Insert(job *Job) error
+	GetAll(filters JobFilters) ([]*Job, Metadata, error)
+	GetById(id int64) (*Job, error)
+	Retry(id int64) (*Job, error)
+	Claim(limit int, lease time.Duration) ([]*Job, error)
+	Complete(id int64, leaseToken string, jobErr error, retry time.Duration) error
+	Release(id int64, leaseToken string) error
+}
+
+type JobModel struct {
+	DB *sql.DB
+}
+
+const jobColumns = `id, kind, payload, status, attempts, max_attempts, run_at, locked_until, last_error,
+	created_at, finished_at`
+
+func scanJob(row scanner, job *Job, extra ...any) error {
+	var payload []byte
+	dest := append(extra,
+		&job.ID,
+		&job.Kind,
+		&payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LockedUntil,
+		&job.LastError,
+		&job.CreatedAt,
+		&job.FinishedAt,
+	)
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+	job.Payload = json.RawMessage(payload)
+	return nil
+}
+
+// Insert queues job to run at job.RunAt, or straight away when it is unset.
+func (m JobModel) Insert(job *Job) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = insertJob(ctx, tx, job); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertJob queues job inside tx, so that it only runs if the change it
+// follows up on commits.
+func insertJob(ctx context.Context, tx *sql.Tx, job *Job) error {
+	query := `
+		INSERT INTO jobs (kind, payload, max_attempts, run_at)
+		VALUES ($1, $2, $3, COALESCE($4, NOW()))
+		RETURNING id, status, run_at, created_at`
+	var runAt *time.Time
+	if !job.RunAt.IsZero() {
+		runAt = &job.RunAt
+	}
+	return tx.QueryRowContext(ctx, query, job.Kind, []byte(job.Payload), job.MaxAttempts, runAt).
+		Scan(&job.ID, &job.Status, &job.RunAt, &job.CreatedAt)
+}
+
+func (m JobModel) GetAll(filters JobFilters) ([]*Job, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), %s
+		FROM jobs
+		WHERE (status = $1 OR $1 = '') AND (kind = $2 OR $2 = '')
+		ORDER BY %s, id
+		LIMIT $3 OFFSET $4`, jobColumns, filters.getOrderBySpec())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.Status, filters.Kind, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	jobs := []*Job{}
+	for rows.Next() {
+		var job Job
+		if err = scanJob(rows, &job, &totalRecords); err != nil {
+			return nil, Metadata{}, err
+		}
+		jobs = append(jobs, &job)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return jobs, calculateMetadata(filters.Page, filters.PageSize, totalRecords), nil
+}
+
+func (m JobModel) GetById(id int64) (*Job, error) {
+	query := fmt.Sprintf(`SELECT %s FROM jobs WHERE id = $1`, jobColumns)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var job Job
+	err := scanJob(m.DB.QueryRowContext(ctx, query, id), &job)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Retry queues a failed or dead job for immediate running with a fresh set
+// of attempts. Jobs in any other state are left alone.
+func (m JobModel) Retry(id int64) (*Job, error) {
+	query := fmt.Sprintf(`
+		UPDATE jobs
+		SET status = 'pending', attempts = 0, run_at = NOW(), finished_at = NULL
+		WHERE id = $1 AND status IN ('failed', 'dead')
+		RETURNING %s`, jobColumns)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var job Job
+	err := scanJob(m.DB.QueryRowContext(ctx, query, id), &job)
+	if err == nil {
+		return &job, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if _, err = m.GetById(id); err != nil {
+		return nil, err
+	}
+	return nil, ErrJobNotRetryable
+}
+
+// Claim marks up to limit due jobs as running for lease and returns them.
+// Running jobs whose lease ran out belong to a worker that went away and are
+// due again.
+func (m JobModel) Claim(limit int, lease time.Duration) ([]*Job, error) {
+	token, err := newLeaseToken()
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf(`
+		UPDATE jobs
+		SET status = 'running', locked_until = NOW() + $2 * interval '1 second', lease_token = $3
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE (status IN ('pending', 'failed') AND run_at <= NOW())
+			OR (status = 'running' AND locked_until < NOW())
+			ORDER BY run_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING %s`, jobColumns)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, lease.Seconds(), token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []*Job{}
+	for rows.Next() {
+		job := Job{LeaseToken: token}
+		if err = scanJob(rows, &job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Complete records the outcome of a run made under the claim leaseToken. A
+// failed run is retried after retry, unless it was the last attempt, in
+// which case the job is dead until someone retries it. It returns
+// ErrLeaseLost when the claim is no longer held.
+func (m JobModel) Complete(id int64, leaseToken string, jobErr error, retry time.Duration) error {
+	lastError := ""
+	if jobErr != nil {
+		lastError = jobErr.Error()
+	}
+
+	query := `
+		UPDATE jobs
+		SET attempts = attempts + 1,
+		    last_error = $2,
+		    locked_until = NULL,
+		    status = CASE
+		        WHEN $2 = '' THEN 'succeeded'
+		        WHEN attempts + 1 >= max_attempts THEN 'dead'
+		        ELSE 'failed' END,
+		    run_at = CASE WHEN $2 = '' THEN run_at ELSE NOW() + $3 * interval '1 second' END,
+		    finished_at = CASE WHEN $2 = '' OR attempts + 1 >= max_attempts THEN NOW() END,
+		    lease_token = NULL
+		WHERE id = $1 AND lease_token = $4`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, lastError, retry.Seconds(), leaseToken)
+	if err != nil {
+		return err
+	}
+	return checkLease(result)
+}
+
+// Release hands an interrupted job back without counting the attempt. It
+// returns ErrLeaseLost when the claim leaseToken is no longer held.
+func (m JobModel) Release(id int64, leaseToken string) error {
+	query := `
+		UPDATE jobs
+		SET status = CASE WHEN attempts = 0 THEN 'pending' ELSE 'failed' END, locked_until = NULL, lease_token = NULL
+		WHERE id = $1 AND status = 'running' AND lease_token = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, leaseToken)
+	if err != nil {
+		return err
+	}
+	return checkLease(result)
+}
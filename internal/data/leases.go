@@ -0,0 +1,34 @@
+package data
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+)
+
+// ErrLeaseLost reports that a queued item was claimed again, or requeued by
+// hand, while an attempt was still being made under an earlier claim.
+var ErrLeaseLost = errors.New("lease lost")
+
+// newLeaseToken returns a random token identifying one claim.
+func newLeaseToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// checkLease turns an update guarded by a lease token that matched nothing
+// into ErrLeaseLost.
+func checkLease(result sql.Result) error {
+	rowAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowAffected == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
@@ -0,0 +1,425 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	ListVisibilityPrivate  = "private"
+	ListVisibilityUnlisted = "unlisted"
+	ListVisibilityPublic   = "public"
+)
+
+var (
+	ErrDuplicateListItem = errors.New("duplicate list item")
+	ErrInvalidListOrder  = errors.New("invalid list order")
+)
+
+type MovieList struct {
+	ID          int64       `json:"id"`
+	UserID      int64       `json:"userId"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Visibility  string      `json:"visibility"`
+	ShareToken  string      `json:"shareToken,omitempty"`
+	CreatedAt   time.Time   `json:"createdAt"`
+	UpdatedAt   time.Time   `json:"updatedAt"`
+	Version     int32       `json:"version"`
+	Items       []*ListItem `json:"items,omitempty"`
+}
+
+// CanView reports whether a user may read the list when it is addressed by id.
+// Unlisted lists are only reachable through their share token.
+func (l *MovieList) CanView(user *User) bool {
+	return l.UserID == user.ID || l.Visibility == ListVisibilityPublic
+}
+
+type ListItem struct {
+	MovieID  int64     `json:"movieId"`
+	Title    string    `json:"title"`
+	Year     int32     `json:"year"`
+	Position int32     `json:"position"`
+	Note     string    `json:"note"`
+	AddedAt  time.Time `json:"addedAt"`
+}
+
+type ListRepository interface {
+	Insert(list *MovieList) error
+	GetById(id int64) (*MovieList, error)
+	GetByShareToken(token string) (*MovieList, error)
+	GetAllForUser(userId int64, filters Filters) ([]*MovieList, Metadata, error)
+	Update(list *MovieList) error
+	Delete(id int64) error
+	AddItem(listId int64, item *ListItem) error
+	RemoveItem(listId int64, movieId int64) error
+	Reorder(listId int64, movieIds []int64) error
+}
+
+type ListModel struct {
+	DB *sql.DB
+}
+
+func NewListFilters() Filters {
+	return Filters{
+		Page:         1,
+		PageSize:     20,
+		Sort:         "-updated_at",
+		SortSafelist: []string{"id", "-id", "name", "-name", "updated_at", "-updated_at"},
+	}
+}
+
+func generateShareToken() (string, error) {
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
+
+func (m ListModel) Insert(list *MovieList) error {
+	token, err := generateShareToken()
+	if err != nil {
+		return err
+	}
+	list.ShareToken = token
+
+	query := `
+		INSERT INTO lists (user_id, name, description, visibility, share_token) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at, version`
+	args := []interface{}{list.UserID, list.Name, list.Description, list.Visibility, list.ShareToken}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&list.ID, &list.CreatedAt, &list.UpdatedAt, &list.Version)
+}
+
+func (m ListModel) GetById(id int64) (*MovieList, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	return m.getOne(`WHERE id = $1`, id)
+}
+
+func (m ListModel) GetByShareToken(token string) (*MovieList, error) {
+	return m.getOne(`WHERE share_token = $1 AND visibility <> 'private'`, token)
+}
+
+func (m ListModel) getOne(where string, arg any) (*MovieList, error) {
+	query := `
+		SELECT id, user_id, name, description, visibility, share_token, created_at, updated_at, version
+		FROM lists ` + where
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var list MovieList
+	err := m.DB.QueryRowContext(ctx, query, arg).Scan(
+		&list.ID,
+		&list.UserID,
+		&list.Name,
+		&list.Description,
+		&list.Visibility,
+		&list.ShareToken,
+		&list.CreatedAt,
+		&list.UpdatedAt,
+		&list.Version,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	list.Items, err = m.getItems(ctx, list.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// getItems returns the items of a list in order. Items pointing at trashed
+// movies are left out until the movie is restored.
+func (m ListModel) getItems(ctx context.Context, listId int64) ([]*ListItem, error) {
+	query := `
+		SELECT list_items.movie_id, movies.title, movies.year, list_items.position, list_items.note, list_items.added_at
+		FROM list_items
+		INNER JOIN movies ON movies.id = list_items.movie_id
+		WHERE list_items.list_id = $1 AND movies.deleted_at IS NULL
+		ORDER BY list_items.position`
+	rows, err := m.DB.QueryContext(ctx, query, listId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*ListItem{}
+	for rows.Next() {
+		var item ListItem
+		err := rows.Scan(&item.MovieID, &item.Title, &item.Year, &item.Position, &item.Note, &item.AddedAt)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (m ListModel) GetAllForUser(userId int64, filters Filters) ([]*MovieList, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, user_id, name, description, visibility, share_token, created_at, updated_at, version
+		FROM lists
+		WHERE user_id = $1
+		ORDER BY %s, id
+		LIMIT $2 OFFSET $3`, filters.getOrderBySpec())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userId, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	lists := []*MovieList{}
+	for rows.Next() {
+		var list MovieList
+		err := rows.Scan(
+			&totalRecords,
+			&list.ID,
+			&list.UserID,
+			&list.Name,
+			&list.Description,
+			&list.Visibility,
+			&list.ShareToken,
+			&list.CreatedAt,
+			&list.UpdatedAt,
+			&list.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		lists = append(lists, &list)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return lists, calculateMetadata(filters.Page, filters.PageSize, totalRecords), nil
+}
+
+func (m ListModel) Update(list *MovieList) error {
+	query := `
+		UPDATE lists
+		SET name = $1, description = $2, visibility = $3, updated_at = NOW(), version = version + 1
+		WHERE id = $4 AND version = $5
+		RETURNING updated_at, version`
+	args := []interface{}{list.Name, list.Description, list.Visibility, list.ID, list.Version}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&list.UpdatedAt, &list.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+		return err
+	}
+	return nil
+}
+
+func (m ListModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `DELETE FROM lists WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// lockList serialises changes to the item positions of a list.
+func lockList(ctx context.Context, tx *sql.Tx, listId int64) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE lists SET updated_at = NOW(), version = version + 1 WHERE id = $1`, listId)
+	return err
+}
+
+// AddItem inserts a movie into a list. A zero Position appends it, otherwise
+// the items from Position onward shift down by one.
+func (m ListModel) AddItem(listId int64, item *ListItem) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = lockList(ctx, tx, listId); err != nil {
+		return err
+	}
+
+	var count int32
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM list_items WHERE list_id = $1`, listId).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if item.Position < 1 || item.Position > count+1 {
+		item.Position = count + 1
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE list_items SET position = position + 1
+		WHERE list_id = $1 AND position >= $2`, listId, item.Position)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO list_items (list_id, movie_id, position, note)
+		SELECT $1, id, $3, $4 FROM movies WHERE id = $2 AND deleted_at IS NULL
+		ON CONFLICT (list_id, movie_id) DO NOTHING
+		RETURNING added_at`
+	args := []interface{}{listId, item.MovieID, item.Position, item.Note}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&item.AddedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			var exists bool
+			err = tx.QueryRowContext(ctx, `
+				SELECT EXISTS (SELECT 1 FROM list_items WHERE list_id = $1 AND movie_id = $2)`,
+				listId, item.MovieID).Scan(&exists)
+			if err != nil {
+				return err
+			}
+			if exists {
+				return ErrDuplicateListItem
+			}
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, `SELECT title, year FROM movies WHERE id = $1`, item.MovieID).Scan(&item.Title, &item.Year)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m ListModel) RemoveItem(listId int64, movieId int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = lockList(ctx, tx, listId); err != nil {
+		return err
+	}
+
+	var position int32
+	err = tx.QueryRowContext(ctx, `
+		DELETE FROM list_items WHERE list_id = $1 AND movie_id = $2
+		RETURNING position`, listId, movieId).Scan(&position)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE list_items SET position = position - 1
+		WHERE list_id = $1 AND position > $2`, listId, position)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Reorder rewrites the item positions to follow movieIds, which must name
+// every visible movie in the list exactly once. Items of trashed movies keep
+// their relative order behind the visible ones.
+func (m ListModel) Reorder(listId int64, movieIds []int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = lockList(ctx, tx, listId); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT list_items.movie_id FROM list_items
+		INNER JOIN movies ON movies.id = list_items.movie_id
+		WHERE list_items.list_id = $1 AND movies.deleted_at IS NULL`, listId)
+	if err != nil {
+		return err
+	}
+	var current []int64
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		current = append(current, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	requested := slices.Clone(movieIds)
+	slices.Sort(current)
+	slices.Sort(requested)
+	if !slices.Equal(current, requested) {
+		return ErrInvalidListOrder
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE list_items SET position = position + $3
+		WHERE list_id = $1 AND movie_id <> ALL($2::bigint[])`, listId, movieIds, len(movieIds))
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE list_items SET position = ordered.position
+		FROM unnest($2::bigint[]) WITH ORDINALITY AS ordered(movie_id, position)
+		WHERE list_items.list_id = $1 AND list_items.movie_id = ordered.movie_id`
+	_, err = tx.ExecContext(ctx, query, listId, movieIds)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,422 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	MailStatusQueued     = "queued"
+	MailStatusFailed     = "failed"
+	MailStatusSent       = "sent"
+	MailStatusDead       = "dead"
+	MailStatusSuppressed = "suppressed"
+)
+
+const (
+	SuppressionBounce      = "bounce"
+	SuppressionUnsubscribe = "unsubscribe"
+)
+
+var ErrSuppressed = errors.New("recipient suppressed")
+
+type MailMessage struct {
+	ID            int64      `json:"id"`
+	Sender        string     `json:"sender"`
+	Recipient     string     `json:"recipient"`
+	Template      string     `json:"template"`
+	Locale        string     `json:"locale"`
+	Subject       string     `json:"subject"`
+	Transactional bool       `json:"transactional"`
+	PlainBody     string     `json:"plainBody,omitempty"`
+	HTMLBody      string     `json:"htmlBody,omitempty"`
+	Status        string     `json:"status"`
+	Attempts      int32      `json:"attempts"`
+	NextAttemptAt time.Time  `json:"nextAttemptAt"`
+	LastAttemptAt *time.Time `json:"lastAttemptAt"`
+	LastError     string     `json:"lastError"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	SentAt        *time.Time `json:"sentAt"`
+	// LeaseToken identifies the claim a message was picked up under.
+	LeaseToken string `json:"-"`
+}
+
+type MailSuppression struct {
+	Email     string    `json:"email"`
+	Reason    string    `json:"reason"`
+	Detail    string    `json:"detail"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type MailFilters struct {
+	Status    string `schema:"status" validate:"omitempty,oneof=queued failed sent dead suppressed"`
+	Recipient string `schema:"recipient" validate:"omitempty,email"`
+	Filters
+}
+
+func NewMailFilters() MailFilters {
+	return MailFilters{
+		Filters: Filters{
+			Page:         1,
+			PageSize:     20,
+			Sort:         "-id",
+			SortSafelist: []string{"id", "-id", "next_attempt_at", "-next_attempt_at"},
+		},
+	}
+}
+
+type SuppressionFilters struct {
+	Reason string `schema:"reason" validate:"omitempty,oneof=bounce unsubscribe complaint manual"`
+	Filters
+}
+
+func NewSuppressionFilters() SuppressionFilters {
+	return SuppressionFilters{
+		Filters: Filters{
+			Page:         1,
+			PageSize:     20,
+			Sort:         "-created_at",
+			SortSafelist: []string{"email", "-email", "created_at", "-created_at"},
+		},
+	}
+}
+
+type MailRepository interface {
+	Insert(msg *MailMessage) error
+	GetAll(filters MailFilters) ([]*MailMessage, Metadata, error)
+	GetById(id int64) (*MailMessage, error)
+	Resend(id int64) (*MailMessage, error)
+	ClaimDue(limit int, lease time.Duration) ([]*MailMessage, error)
+	Postpone(id int64, leaseToken string, delay time.Duration) error
+	Complete(id int64, leaseToken string, sent bool, deliveryErr error, permanent bool, retry time.Duration, maxAttempts int) error
+	Prune(retention time.Duration) (int64, error)
+	Suppress(suppression *MailSuppression) error
+	Unsuppress(email string) error
+	GetSuppressions(filters SuppressionFilters) ([]*MailSuppression, Metadata, error)
+}
+
+type MailModel struct {
+	DB *sql.DB
+}
+
+const mailSummaryColumns = `id, sender, recipient, template, locale, subject, transactional, status, attempts,
+	next_attempt_at, last_attempt_at, last_error, created_at, sent_at`
+
+func mailSummaryDest(msg *MailMessage) []any {
+	return []any{
+		&msg.ID,
+		&msg.Sender,
+		&msg.Recipient,
+		&msg.Template,
+		&msg.Locale,
+		&msg.Subject,
+		&msg.Transactional,
+		&msg.Status,
+		&msg.Attempts,
+		&msg.NextAttemptAt,
+		&msg.LastAttemptAt,
+		&msg.LastError,
+		&msg.CreatedAt,
+		&msg.SentAt,
+	}
+}
+
+const mailColumns = mailSummaryColumns + `, plain_body, html_body`
+
+func mailDest(msg *MailMessage) []any {
+	return append(mailSummaryDest(msg), &msg.PlainBody, &msg.HTMLBody)
+}
+
+// Insert queues msg, unless its recipient is suppressed, in which case it is
+// stored as suppressed and never sent. Transactional mail is only held back
+// for recipients that bounced.
+func (m MailModel) Insert(msg *MailMessage) error {
+	query := `
+		INSERT INTO mail_messages (sender, recipient, template, locale, subject, transactional, plain_body, html_body, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8,
+		        CASE WHEN EXISTS (
+		            SELECT 1 FROM mail_suppressions WHERE email = $2 AND (reason = 'bounce' OR NOT $6)
+		        ) THEN 'suppressed' ELSE 'queued' END)
+		RETURNING id, status, next_attempt_at, created_at`
+	args := []any{msg.Sender, msg.Recipient, msg.Template, msg.Locale, msg.Subject, msg.Transactional, msg.PlainBody, msg.HTMLBody}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&msg.ID, &msg.Status, &msg.NextAttemptAt, &msg.CreatedAt)
+}
+
+// GetAll lists messages without their bodies.
+func (m MailModel) GetAll(filters MailFilters) ([]*MailMessage, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), %s
+		FROM mail_messages
+		WHERE (status = $1 OR $1 = '') AND (recipient = $2 OR $2 = '')
+		ORDER BY %s, id
+		LIMIT $3 OFFSET $4`, mailSummaryColumns, filters.getOrderBySpec())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.Status, filters.Recipient, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	messages := []*MailMessage{}
+	for rows.Next() {
+		var msg MailMessage
+		err = rows.Scan(append([]any{&totalRecords}, mailSummaryDest(&msg)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		messages = append(messages, &msg)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return messages, calculateMetadata(filters.Page, filters.PageSize, totalRecords), nil
+}
+
+func (m MailModel) GetById(id int64) (*MailMessage, error) {
+	query := fmt.Sprintf(`SELECT %s FROM mail_messages WHERE id = $1`, mailColumns)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var msg MailMessage
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(mailDest(&msg)...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// Resend queues a message for immediate sending with a fresh set of
+// attempts, whatever became of it before. Recipients suppressed for it have
+// to be removed from the suppression list first.
+func (m MailModel) Resend(id int64) (*MailMessage, error) {
+	query := fmt.Sprintf(`
+		UPDATE mail_messages
+		SET status = 'queued', attempts = 0, next_attempt_at = NOW(), sent_at = NULL, lease_token = NULL
+		WHERE id = $1
+		AND NOT EXISTS (
+			SELECT 1 FROM mail_suppressions WHERE email = mail_messages.recipient
+			AND (reason = 'bounce' OR NOT mail_messages.transactional))
+		RETURNING %s`, mailSummaryColumns)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var msg MailMessage
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(mailSummaryDest(&msg)...)
+	if err == nil {
+		return &msg, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if _, err = m.GetById(id); err != nil {
+		return nil, err
+	}
+	return nil, ErrSuppressed
+}
+
+// ClaimDue picks up to limit due messages and leases them so that no other
+// sender takes them up until the lease runs out. The lease has to cover
+// sending every claimed message; the outcome is only recorded under it.
+func (m MailModel) ClaimDue(limit int, lease time.Duration) ([]*MailMessage, error) {
+	token, err := newLeaseToken()
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf(`
+		UPDATE mail_messages
+		SET next_attempt_at = NOW() + $2 * interval '1 second', lease_token = $3
+		WHERE id IN (
+			SELECT id FROM mail_messages
+			WHERE status IN ('queued', 'failed') AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING %s`, mailColumns)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, lease.Seconds(), token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	due := []*MailMessage{}
+	for rows.Next() {
+		msg := MailMessage{LeaseToken: token}
+		if err = rows.Scan(mailDest(&msg)...); err != nil {
+			return nil, err
+		}
+		due = append(due, &msg)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return due, nil
+}
+
+// Postpone hands a claimed message back to be sent after delay, without
+// counting an attempt.
+func (m MailModel) Postpone(id int64, leaseToken string, delay time.Duration) error {
+	query := `
+		UPDATE mail_messages
+		SET next_attempt_at = NOW() + $2 * interval '1 second', lease_token = NULL
+		WHERE id = $1 AND lease_token = $3`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, delay.Seconds(), leaseToken)
+	if err != nil {
+		return err
+	}
+	return checkLease(result)
+}
+
+// Complete records the outcome of an attempt made under the claim
+// leaseToken. A failed attempt is retried after retry unless the failure is
+// permanent or it was the last of maxAttempts, in which case the message is
+// dead until someone resends it. It returns ErrLeaseLost when the claim is
+// no longer held.
+func (m MailModel) Complete(id int64, leaseToken string, sent bool, deliveryErr error, permanent bool, retry time.Duration, maxAttempts int) error {
+	lastError := ""
+	if deliveryErr != nil {
+		lastError = deliveryErr.Error()
+	}
+
+	query := `
+		UPDATE mail_messages
+		SET attempts = attempts + 1,
+		    last_attempt_at = NOW(),
+		    last_error = $2,
+		    status = CASE
+		        WHEN $6 THEN 'sent'
+		        WHEN $3 OR attempts + 1 >= $5 THEN 'dead'
+		        ELSE 'failed' END,
+		    sent_at = CASE WHEN $6 THEN NOW() END,
+		    next_attempt_at = NOW() + $4 * interval '1 second',
+		    lease_token = NULL
+		WHERE id = $1 AND lease_token = $7`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, lastError, permanent, retry.Seconds(), maxAttempts, sent, leaseToken)
+	if err != nil {
+		return err
+	}
+	return checkLease(result)
+}
+
+// Prune deletes messages that were sent, dead or suppressed longer than
+// retention ago.
+func (m MailModel) Prune(retention time.Duration) (int64, error) {
+	query := `
+		DELETE FROM mail_messages
+		WHERE status IN ('sent', 'dead', 'suppressed') AND created_at < $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Suppress adds an address to the suppression list, or updates why it is on
+// it, and withdraws the mail still waiting to go to it. Only a bounce
+// withdraws transactional mail.
+func (m MailModel) Suppress(suppression *MailSuppression) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO mail_suppressions (email, reason, detail)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (email) DO UPDATE SET reason = EXCLUDED.reason, detail = EXCLUDED.detail
+		RETURNING email, created_at`
+	err = tx.QueryRowContext(ctx, query, suppression.Email, suppression.Reason, suppression.Detail).
+		Scan(&suppression.Email, &suppression.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		UPDATE mail_messages SET status = 'suppressed'
+		WHERE recipient = $1 AND status IN ('queued', 'failed')
+		AND ($2 = 'bounce' OR NOT transactional)`
+	_, err = tx.ExecContext(ctx, query, suppression.Email, suppression.Reason)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m MailModel) Unsuppress(email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM mail_suppressions WHERE email = $1`, email)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m MailModel) GetSuppressions(filters SuppressionFilters) ([]*MailSuppression, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), email, reason, detail, created_at
+		FROM mail_suppressions
+		WHERE reason = $1 OR $1 = ''
+		ORDER BY %s, email
+		LIMIT $2 OFFSET $3`, filters.getOrderBySpec())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.Reason, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	suppressions := []*MailSuppression{}
+	for rows.Next() {
+		var s MailSuppression
+		err = rows.Scan(&totalRecords, &s.Email, &s.Reason, &s.Detail, &s.CreatedAt)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		suppressions = append(suppressions, &s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return suppressions, calculateMetadata(filters.Page, filters.PageSize, totalRecords), nil
+}
@@ -0,0 +1,129 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+type MaintenanceRepository interface {
+	TryRun(ctx context.Context, name string, slot time.Time, fn func(ctx context.Context) (string, error)) (bool, string, error)
+	RefreshMaterializedViews(ctx context.Context) ([]string, error)
+}
+
+type MaintenanceModel struct {
+	DB *sql.DB
+}
+
+// TryRun runs fn as the slot of scheduled job name. A session advisory lock
+// keeps two replicas from running the job at once, and the slot recorded in
+// scheduled_jobs keeps a replica that arrives late from running it again.
+func (m MaintenanceModel) TryRun(ctx context.Context, name string, slot time.Time, fn func(ctx context.Context) (string, error)) (bool, string, error) {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return false, "", err
+	}
+	defer conn.Close()
+
+	key := "scheduler:" + name
+	var locked bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtextextended($1, 0))`, key).Scan(&locked)
+	if err != nil || !locked {
+		return false, "", err
+	}
+	defer func() {
+		unlockCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		_, err := conn.ExecContext(unlockCtx, `SELECT pg_advisory_unlock(hashtextextended($1, 0))`, key)
+		if err != nil {
+			// The lock lives as long as the session, which must not go back
+			// to the pool still holding it.
+			_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+
+	query := `
+		INSERT INTO scheduled_jobs (name, slot)
+		VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE
+		SET slot = EXCLUDED.slot, started_at = NOW(), finished_at = NULL, last_error = ''
+		WHERE scheduled_jobs.slot < EXCLUDED.slot`
+	result, err := conn.ExecContext(ctx, query, name, slot)
+	if err != nil {
+		return false, "", err
+	}
+	claimed, err := result.RowsAffected()
+	if err != nil || claimed == 0 {
+		return false, "", err
+	}
+
+	outcome, runErr := fn(ctx)
+
+	lastError := ""
+	if runErr != nil {
+		lastError = runErr.Error()
+	}
+	finishCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err = conn.ExecContext(finishCtx, `UPDATE scheduled_jobs SET finished_at = NOW(), last_error = $2 WHERE name = $1`, name, lastError)
+	if runErr != nil {
+		return true, outcome, runErr
+	}
+	return true, outcome, err
+}
+
+// RefreshMaterializedViews refreshes every materialized view in the schema,
+// concurrently where a unique index allows it so that reads carry on, and
+// returns their names.
+func (m MaintenanceModel) RefreshMaterializedViews(ctx context.Context) ([]string, error) {
+	query := `
+		SELECT matviewname, EXISTS (
+			SELECT 1 FROM pg_index
+			WHERE indrelid = format('%I.%I', schemaname, matviewname)::regclass AND indisunique)
+		FROM pg_matviews
+		WHERE schemaname = current_schema()
+		ORDER BY matviewname`
+	listCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(listCtx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type view struct {
+		name       string
+		concurrent bool
+	}
+	var views []view
+	for rows.Next() {
+		var v view
+		if err = rows.Scan(&v.name, &v.concurrent); err != nil {
+			return nil, err
+		}
+		views = append(views, v)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	refreshed := []string{}
+	for _, v := range views {
+		refresh := "REFRESH MATERIALIZED VIEW "
+		if v.concurrent {
+			refresh += "CONCURRENTLY "
+		}
+		refreshCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+		_, err = m.DB.ExecContext(refreshCtx, refresh+pgx.Identifier{v.name}.Sanitize())
+		cancel()
+		if err != nil {
+			return refreshed, fmt.Errorf("refreshing %s: %w", v.name, err)
+		}
+		refreshed = append(refreshed, v.name)
+	}
+	return refreshed, nil
+}
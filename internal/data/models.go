@@ -11,10 +11,28 @@ var (
 )
 
 type Models struct {
-	Movies      MovieRepository
-	Users       UserRepository
-	Tokens      TokenRepository
-	Permissions PermissionRepository
+	Movies          MovieRepository
+	Revisions       MovieRevisionRepository
+	Events          MovieEventRepository
+	Titles          MovieTitleRepository
+	Translations    MovieTranslationRepository
+	Images          MovieImageRepository
+	Ratings         RatingRepository
+	Recommendations RecommendationRepository
+	Reviews         ReviewRepository
+	Lists           ListRepository
+	People          PersonRepository
+	Credits         CreditRepository
+	Genres          GenreRepository
+	Collections     CollectionRepository
+	Stats           StatsRepository
+	Jobs            JobRepository
+	Mail            MailRepository
+	Maintenance     MaintenanceRepository
+	Webhooks        WebhookRepository
+	Users           UserRepository
+	Tokens          TokenRepository
+	Permissions     PermissionRepository
 }
 
 func NewModels(db *sql.DB) Models {
@@ -22,6 +40,60 @@ func NewModels(db *sql.DB) Models {
 		Movies: MovieModel{
 			DB: db,
 		},
+		Revisions: MovieRevisionModel{
+			DB: db,
+		},
+		Events: MovieEventModel{
+			DB: db,
+		},
+		Titles: MovieTitleModel{
+			DB: db,
+		},
+		Translations: MovieTranslationModel{
+			DB: db,
+		},
+		Images: MovieImageModel{
+			DB: db,
+		},
+		Ratings: RatingModel{
+			DB: db,
+		},
+		Recommendations: RecommendationModel{
+			DB: db,
+		},
+		Reviews: ReviewModel{
+			DB: db,
+		},
+		Lists: ListModel{
+			DB: db,
+		},
+		People: PersonModel{
+			DB: db,
+		},
+		Credits: CreditModel{
+			DB: db,
+		},
+		Genres: GenreModel{
+			DB: db,
+		},
+		Collections: CollectionModel{
+			DB: db,
+		},
+		Stats: StatsModel{
+			DB: db,
+		},
+		Jobs: JobModel{
+			DB: db,
+		},
+		Mail: MailModel{
+			DB: db,
+		},
+		Maintenance: MaintenanceModel{
+			DB: db,
+		},
+		Webhooks: WebhookModel{
+			DB: db,
+		},
 		Users: UserModel{
 			DB: db,
 		},
@@ -0,0 +1,193 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+const (
+	RevisionActionInsert  = "insert"
+	RevisionActionUpdate  = "update"
+	RevisionActionDelete  = "delete"
+	RevisionActionRestore = "restore"
+	RevisionActionMerge   = "merge"
+	RevisionActionPurge   = "purge"
+)
+
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+type MovieRevision struct {
+	ID        int64                  `json:"id"`
+	MovieID   int64                  `json:"movieId"`
+	Version   int32                  `json:"version"`
+	Action    string                 `json:"action"`
+	UserID    *int64                 `json:"userId"`
+	CreatedAt time.Time              `json:"createdAt"`
+	Snapshot  Movie                  `json:"snapshot"`
+	Diff      map[string]FieldChange `json:"diff"`
+}
+
+// diffMovies lists the user editable fields that differ between two states of
+// a movie. Either side may be nil for inserts and deletes.
+func diffMovies(before, after *Movie) map[string]FieldChange {
+	if before == nil {
+		before = &Movie{}
+	}
+	if after == nil {
+		after = &Movie{}
+	}
+	diff := map[string]FieldChange{}
+	if before.Title != after.Title {
+		diff["title"] = FieldChange{From: before.Title, To: after.Title}
+	}
+	if before.Year != after.Year {
+		diff["year"] = FieldChange{From: before.Year, To: after.Year}
+	}
+	if before.Runtime != after.Runtime {
+		diff["runtime"] = FieldChange{From: before.Runtime, To: after.Runtime}
+	}
+	if !slices.Equal(before.Genres, after.Genres) {
+		diff["genres"] = FieldChange{From: before.Genres, To: after.Genres}
+	}
+	if !maps.Equal(before.ExternalIDs, after.ExternalIDs) {
+		diff["externalIds"] = FieldChange{From: before.ExternalIDs, To: after.ExternalIDs}
+	}
+	return diff
+}
+
+// recordRevision appends a revision for movie inside tx, so the revision
+// commits or rolls back together with the change it describes.
+func recordRevision(ctx context.Context, tx *sql.Tx, action string, userId int64, before, after *Movie) error {
+	snapshot := after
+	if snapshot == nil {
+		snapshot = before
+	}
+	snapshotJson, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	diffJson, err := json.Marshal(diffMovies(before, after))
+	if err != nil {
+		return err
+	}
+
+	var actor *int64
+	if userId > 0 {
+		actor = &userId
+	}
+
+	query := `
+		INSERT INTO movie_revisions (movie_id, version, action, user_id, snapshot, diff)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	args := []interface{}{snapshot.ID, snapshot.Version, action, actor, snapshotJson, diffJson}
+	_, err = tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+type MovieRevisionRepository interface {
+	GetAllForMovie(movieId int64, filters Filters) ([]*MovieRevision, Metadata, error)
+	GetByVersion(movieId int64, version int32) (*MovieRevision, error)
+}
+
+type MovieRevisionModel struct {
+	DB *sql.DB
+}
+
+func NewRevisionFilters() Filters {
+	return Filters{
+		Page:         1,
+		PageSize:     20,
+		Sort:         "-version",
+		SortSafelist: []string{"version", "-version"},
+	}
+}
+
+func (m MovieRevisionModel) GetAllForMovie(movieId int64, filters Filters) ([]*MovieRevision, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, movie_id, version, action, user_id, created_at, snapshot, diff
+		FROM movie_revisions
+		WHERE movie_id = $1
+		ORDER BY %s, id
+		LIMIT $2 OFFSET $3`, filters.getOrderBySpec())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieId, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*MovieRevision{}
+	for rows.Next() {
+		var revision MovieRevision
+		err := scanRevision(rows, &totalRecords, &revision)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		revisions = append(revisions, &revision)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return revisions, calculateMetadata(filters.Page, filters.PageSize, totalRecords), nil
+}
+
+func (m MovieRevisionModel) GetByVersion(movieId int64, version int32) (*MovieRevision, error) {
+	query := `
+		SELECT 1, id, movie_id, version, action, user_id, created_at, snapshot, diff
+		FROM movie_revisions
+		WHERE movie_id = $1 AND version = $2
+		ORDER BY id DESC
+		LIMIT 1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var total int
+	var revision MovieRevision
+	err := scanRevision(m.DB.QueryRowContext(ctx, query, movieId, version), &total, &revision)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &revision, nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRevision(row scanner, total *int, revision *MovieRevision) error {
+	var snapshot, diff []byte
+	err := row.Scan(
+		total,
+		&revision.ID,
+		&revision.MovieID,
+		&revision.Version,
+		&revision.Action,
+		&revision.UserID,
+		&revision.CreatedAt,
+		&snapshot,
+		&diff,
+	)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(snapshot, &revision.Snapshot); err != nil {
+		return err
+	}
+	return json.Unmarshal(diff, &revision.Diff)
+}
@@ -10,32 +10,90 @@ import (
 )
 
 type Movie struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"-"`
-	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitempty"`
-	Runtime   Runtime   `json:"runtime"`
-	Genres    []string  `json:"genres"`
-	Version   int32     `json:"version,omitempty"`
+	ID          int64                   `json:"id"`
+	CreatedAt   time.Time               `json:"-"`
+	UpdatedAt   time.Time               `json:"-"`
+	Title       string                  `json:"title"`
+	Year        int32                   `json:"year,omitempty"`
+	Runtime     Runtime                 `json:"runtime"`
+	Genres      []string                `json:"genres"`
+	Version     int32                   `json:"version,omitempty"`
+	Rating      float64                 `json:"rating"`
+	RatingCount int32                   `json:"ratingCount"`
+	DeletedAt   *time.Time              `json:"deletedAt,omitempty"`
+	Credits     []*Credit               `json:"credits,omitempty"`
+	Collections []*CollectionMembership `json:"collections,omitempty"`
+	// ExternalIDs maps a source such as imdb to the movie's id there. A nil
+	// map leaves the stored identifiers untouched on Insert and Update.
+	ExternalIDs map[string]string `json:"externalIds,omitempty"`
+	// OriginalTitle and TitleLocale are only set once Title has been
+	// replaced by a localised title.
+	OriginalTitle string        `json:"originalTitle,omitempty"`
+	TitleLocale   string        `json:"titleLocale,omitempty"`
+	Titles        []*MovieTitle `json:"titles,omitempty"`
+	// Tagline and Overview only exist as translations, filled in from the
+	// locale named by TranslationLocale.
+	Tagline           string              `json:"tagline,omitempty"`
+	Overview          string              `json:"overview,omitempty"`
+	TranslationLocale string              `json:"translationLocale,omitempty"`
+	Translations      []*MovieTranslation `json:"translations,omitempty"`
+	Images            []*MovieImage       `json:"images,omitempty"`
 }
 
 type MovieRepository interface {
-	Insert(movie *Movie) error
+	Insert(movie *Movie, userId int64) error
 	GetById(id int64) (*Movie, error)
 	Get(filters MovieFilters) ([]*Movie, Metadata, error)
-	Update(movie *Movie) error
-	Delete(id int64) error
+	Update(movie *Movie, userId int64) error
+	Delete(id int64, version int32, userId int64) error
+	Restore(id int64, userId int64) (*Movie, error)
+	GetDeleted(filters MovieFilters) ([]*Movie, Metadata, error)
+	PurgeDeleted(retention time.Duration) (int64, error)
+	GetIdByExternalID(source string, externalId string) (int64, error)
+	GetDuplicateCandidates(filters Filters) ([]*DuplicateCandidate, Metadata, error)
+	Merge(id int64, targetId int64, userId int64) (*Movie, error)
+	GetRedirect(id int64) (int64, error)
+	GetSimilar(id int64, weights SimilarityWeights, filters Filters) ([]*SimilarMovie, Metadata, error)
+	Export(ctx context.Context, filters MovieFilters, batchSize int, fn func(*Movie) error) error
 }
 
 type MovieModel struct {
 	DB *sql.DB
 }
 
-func (m MovieModel) Insert(movie *Movie) error {
+func (m MovieModel) Insert(movie *Movie, userId int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `INSERT INTO movies (title, year, runtime, genres) VALUES ($1, $2, $3, $4)
-			RETURNING id, created_at, version`
+			RETURNING id, created_at, updated_at, version`
 	params := []interface{}{movie.Title, movie.Year, movie.Runtime, movie.Genres}
-	return m.DB.QueryRow(query, params...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	err = tx.QueryRowContext(ctx, query, params...).Scan(&movie.ID, &movie.CreatedAt, &movie.UpdatedAt, &movie.Version)
+	if err != nil {
+		return err
+	}
+
+	if movie.ExternalIDs != nil {
+		err = saveExternalIDs(ctx, tx, movie.ID, movie.ExternalIDs)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = recordRevision(ctx, tx, RevisionActionInsert, userId, nil, movie)
+	if err != nil {
+		return err
+	}
+	err = recordEvent(ctx, tx, EventMovieCreated, movie)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (m MovieModel) GetById(id int64) (*Movie, error) {
@@ -43,8 +101,8 @@ func (m MovieModel) GetById(id int64) (*Movie, error) {
 		return nil, ErrRecordNotFound
 	}
 	query := `
-		SELECT id, created_at, title, year, runtime, genres, version FROM movies
-		WHERE id = $1`
+		SELECT id, created_at, updated_at, title, year, runtime, genres, version, rating, rating_count FROM movies
+		WHERE id = $1 AND deleted_at IS NULL`
 
 	pgMap := pgtype.NewMap()
 	var movie Movie
@@ -53,11 +111,14 @@ func (m MovieModel) GetById(id int64) (*Movie, error) {
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
 		&movie.ID,
 		&movie.CreatedAt,
+		&movie.UpdatedAt,
 		&movie.Title,
 		&movie.Year,
 		&movie.Runtime,
 		pgMap.SQLScanner(&movie.Genres),
 		&movie.Version,
+		&movie.Rating,
+		&movie.RatingCount,
 	)
 
 	if err != nil {
@@ -67,15 +128,150 @@ func (m MovieModel) GetById(id int64) (*Movie, error) {
 		return nil, err
 	}
 
+	movie.ExternalIDs, err = getExternalIDs(ctx, m.DB, movie.ID)
+	if err != nil {
+		return nil, err
+	}
+
 	return &movie, nil
 }
 
-func (m MovieModel) Update(movie *Movie) error {
+// getForUpdate loads and row locks the current state of a movie inside tx.
+// Trashed movies are returned too, callers decide whether that is acceptable.
+func (m MovieModel) getForUpdate(ctx context.Context, tx *sql.Tx, id int64) (*Movie, error) {
+	movies, err := queryMovies(ctx, tx, `WHERE id = $1 FOR UPDATE`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(movies) == 0 {
+		return nil, ErrRecordNotFound
+	}
+	movie := movies[0]
+	movie.ExternalIDs, err = getExternalIDs(ctx, tx, movie.ID)
+	if err != nil {
+		return nil, err
+	}
+	return movie, nil
+}
+
+// movieRowColumns are the columns of the movies row scanned by scanMovies.
+const movieRowColumns = `id, created_at, updated_at, title, year, runtime, genres, version, rating, rating_count, deleted_at`
+
+// queryMovies loads the movies rows, trashed ones included, selected by
+// clause, which follows FROM movies and typically ends in a locking clause.
+func queryMovies(ctx context.Context, tx *sql.Tx, clause string, args ...any) ([]*Movie, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT `+movieRowColumns+` FROM movies `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanMovies(rows)
+}
+
+func scanMovies(rows *sql.Rows) ([]*Movie, error) {
+	defer rows.Close()
+
+	pgMap := pgtype.NewMap()
+	movies := []*Movie{}
+	for rows.Next() {
+		var movie Movie
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.UpdatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pgMap.SQLScanner(&movie.Genres),
+			&movie.Version,
+			&movie.Rating,
+			&movie.RatingCount,
+			&movie.DeletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, &movie)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return movies, nil
+}
+
+// touchMovies moves the live movies matching condition on to a new version
+// inside tx and records an update event for each of them. Changes to data
+// embedded in the movie representation but stored elsewhere, such as
+// credits, call it so that ETags, Last-Modified and subscribers follow them.
+func touchMovies(ctx context.Context, tx *sql.Tx, condition string, args ...any) ([]*Movie, error) {
+	query := `
+		UPDATE movies SET version = version + 1, updated_at = NOW()
+		WHERE deleted_at IS NULL AND ` + condition + `
+		RETURNING ` + movieRowColumns
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	movies, err := scanMovies(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, movie := range movies {
+		if err = recordEvent(ctx, tx, EventMovieUpdated, movie); err != nil {
+			return nil, err
+		}
+	}
+	return movies, nil
+}
+
+// touchMovie is touchMovies for a single live movie.
+func touchMovie(ctx context.Context, tx *sql.Tx, id int64) error {
+	movies, err := touchMovies(ctx, tx, `id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if len(movies) == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m MovieModel) Update(movie *Movie, userId int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := m.getForUpdate(ctx, tx, movie.ID)
+	if err != nil {
+		if errors.Is(err, ErrRecordNotFound) {
+			return ErrEditConflict
+		}
+		return err
+	}
+	if before.DeletedAt != nil {
+		return ErrEditConflict
+	}
+
+	err = updateMovie(ctx, tx, before, movie, userId)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateMovie saves the editable fields of movie over before, its row locked
+// state, inside tx. It fails with ErrEditConflict unless movie is still at the
+// version it was read at, and records the revision and, for movies not in the
+// trash, the event every edit leaves behind.
+func updateMovie(ctx context.Context, tx *sql.Tx, before *Movie, movie *Movie, userId int64) error {
 	query := `
 		UPDATE movies
-		SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1 
+		SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1, updated_at = NOW()
 		WHERE id = $5 AND version = $6
-		RETURNING version`
+		RETURNING version, updated_at`
 
 	args := []interface{}{
 		movie.Title,
@@ -85,51 +281,264 @@ func (m MovieModel) Update(movie *Movie) error {
 		movie.ID,
 		movie.Version,
 	}
-	err := m.DB.QueryRow(query, args...).Scan(&movie.Version)
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&movie.Version, &movie.UpdatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return ErrEditConflict
 		}
 		return err
 	}
-	return nil
+
+	if movie.ExternalIDs != nil {
+		err = saveExternalIDs(ctx, tx, movie.ID, movie.ExternalIDs)
+		if err != nil {
+			return err
+		}
+	} else {
+		// Untouched, so the revision records them as they were.
+		movie.ExternalIDs, err = getExternalIDs(ctx, tx, movie.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = recordRevision(ctx, tx, RevisionActionUpdate, userId, before, movie)
+	if err != nil {
+		return err
+	}
+	if movie.DeletedAt != nil {
+		return nil
+	}
+	return recordEvent(ctx, tx, EventMovieUpdated, movie)
 }
 
-func (m MovieModel) Delete(id int64) error {
+// Delete moves a movie to the trash. It stays restorable until PurgeDeleted
+// removes it for good. A non zero version makes the delete conditional on the
+// movie still being at that version, failing with ErrEditConflict otherwise.
+func (m MovieModel) Delete(id int64, version int32, userId int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	query := `DELETE FROM movies WHERE id = $1`
+	before, err := m.getForUpdate(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt != nil {
+		return ErrRecordNotFound
+	}
+	if version != 0 && before.Version != version {
+		return ErrEditConflict
+	}
 
-	result, err := m.DB.Exec(query, id)
+	query := `
+		UPDATE movies
+		SET deleted_at = NOW(), version = version + 1, updated_at = NOW()
+		WHERE id = $1
+		RETURNING version, updated_at, deleted_at`
+	after := *before
+	err = tx.QueryRowContext(ctx, query, id).Scan(&after.Version, &after.UpdatedAt, &after.DeletedAt)
 	if err != nil {
 		return err
 	}
 
-	rowAffected, err := result.RowsAffected()
+	err = recordRevision(ctx, tx, RevisionActionDelete, userId, before, &after)
+	if err != nil {
+		return err
+	}
+	err = recordEvent(ctx, tx, EventMovieDeleted, &after)
 	if err != nil {
 		return err
 	}
+	return tx.Commit()
+}
 
-	if rowAffected == 0 {
-		return ErrRecordNotFound
+// Restore takes a movie back out of the trash.
+func (m MovieModel) Restore(id int64, userId int64) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
 	}
-	return nil
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	before, err := m.getForUpdate(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if before.DeletedAt == nil {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE movies
+		SET deleted_at = NULL, version = version + 1, updated_at = NOW()
+		WHERE id = $1
+		RETURNING version, updated_at`
+	after := *before
+	after.DeletedAt = nil
+	err = tx.QueryRowContext(ctx, query, id).Scan(&after.Version, &after.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordRevision(ctx, tx, RevisionActionRestore, userId, before, &after)
+	if err != nil {
+		return nil, err
+	}
+	// Subscribers dropped the movie when it was trashed, to them it is new.
+	err = recordEvent(ctx, tx, EventMovieCreated, &after)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &after, nil
+}
+
+// PurgeDeleted permanently removes movies that have been in the trash for
+// longer than retention and reports how many were removed. Each purge leaves
+// a final revision and a purged event behind, as the movie row itself is gone.
+func (m MovieModel) PurgeDeleted(retention time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	expired, err := queryMovies(ctx, tx, `WHERE deleted_at < $1 FOR UPDATE SKIP LOCKED`, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, before := range expired {
+		after := *before
+		after.Version++
+		err = recordRevision(ctx, tx, RevisionActionPurge, 0, before, &after)
+		if err != nil {
+			return 0, err
+		}
+		err = recordEvent(ctx, tx, EventMoviePurged, &after)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM movies WHERE id = $1`, before.ID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int64(len(expired)), nil
+}
+
+// movieFilterClause renders the search conditions shared by every movie
+// listing, numbering its placeholders from $1. Callers append their own
+// arguments after the returned ones.
+func movieFilterClause(filters MovieFilters) (string, []interface{}) {
+	clause := `(to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = ''
+			OR EXISTS (
+				SELECT 1 FROM movie_titles WHERE movie_titles.movie_id = movies.id
+				AND to_tsvector(movie_titles.search_config, movie_titles.title)
+					@@ plainto_tsquery(movie_titles.search_config, $1)))
+		AND (genres @> $2 OR $2 = '{}')
+		AND ($3::bigint = 0 OR EXISTS (
+			SELECT 1 FROM credits WHERE credits.movie_id = movies.id AND credits.person_id = $3))
+		AND ($4::bigint = 0 OR EXISTS (
+			SELECT 1 FROM credits WHERE credits.movie_id = movies.id AND credits.person_id = $4
+			AND credits.role = 'director'))
+		AND ($5::bigint = 0 OR id IN (
+			WITH RECURSIVE tree (id, path) AS (
+				SELECT id, ARRAY[id] FROM collections WHERE id = $5
+				UNION ALL
+				SELECT collections.id, tree.path || collections.id FROM collections
+				INNER JOIN tree ON collections.parent_id = tree.id
+				WHERE NOT collections.id = ANY (tree.path)
+			)
+			SELECT movie_id FROM collection_movies WHERE collection_id IN (SELECT id FROM tree)))`
+	return clause, []interface{}{filters.Title, filters.Genres, filters.Person, filters.Director, filters.Collection}
+}
+
+func (m MovieModel) GetDeleted(filters MovieFilters) ([]*Movie, Metadata, error) {
+	where, args := movieFilterClause(filters)
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, created_at, title, year, runtime, genres, version, rating, rating_count, deleted_at
+		FROM movies
+		WHERE deleted_at IS NOT NULL
+		AND %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+		`, where, filters.getOrderBySpec(), len(args)+1, len(args)+2)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	args = append(args, filters.limit(), filters.offset())
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+	totalRecords := 0
+	movies := []*Movie{}
+	pgMap := pgtype.NewMap()
+
+	for rows.Next() {
+		var movie Movie
+		err := rows.Scan(
+			&totalRecords,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pgMap.SQLScanner(&movie.Genres),
+			&movie.Version,
+			&movie.Rating,
+			&movie.RatingCount,
+			&movie.DeletedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return movies, calculateMetadata(filters.Page, filters.PageSize, totalRecords), nil
 }
 
 func (m MovieModel) Get(filters MovieFilters) ([]*Movie, Metadata, error) {
+	where, args := movieFilterClause(filters)
 	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, created_at, title, year, runtime, genres, version
+		SELECT COUNT(*) OVER(), id, created_at, title, year, runtime, genres, version, rating, rating_count
 		FROM movies
-		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		AND (genres @> $2 OR $2 = '{}')
+		WHERE deleted_at IS NULL
+		AND %s
 		ORDER BY %s
-		LIMIT $3 OFFSET $4
-		`, filters.getOrderBySpec())
+		LIMIT $%d OFFSET $%d
+		`, where, filters.getOrderBySpec(), len(args)+1, len(args)+2)
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	args := []interface{}{filters.Title, filters.Genres, filters.limit(), filters.offset()}
+	args = append(args, filters.limit(), filters.offset())
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
@@ -151,6 +560,8 @@ func (m MovieModel) Get(filters MovieFilters) ([]*Movie, Metadata, error) {
 			&movie.Runtime,
 			pgMap.SQLScanner(&movie.Genres),
 			&movie.Version,
+			&movie.Rating,
+			&movie.RatingCount,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
@@ -164,3 +575,72 @@ func (m MovieModel) Get(filters MovieFilters) ([]*Movie, Metadata, error) {
 
 	return movies, calculateMetadata(filters.Page, filters.PageSize, totalRecords), nil
 }
+
+// Export streams every movie matching filters to fn, fetching batchSize rows
+// at a time through a server-side cursor so the full result set is never held
+// in memory. Paging in filters is ignored, sorting is honoured.
+func (m MovieModel) Export(ctx context.Context, filters MovieFilters, batchSize int, fn func(*Movie) error) error {
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	where, args := movieFilterClause(filters)
+	query := fmt.Sprintf(`
+		DECLARE movies_export NO SCROLL CURSOR FOR
+		SELECT id, created_at, title, year, runtime, genres, version, rating, rating_count
+		FROM movies
+		WHERE deleted_at IS NULL
+		AND %s
+		ORDER BY %s, id`, where, filters.getOrderBySpec())
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	pgMap := pgtype.NewMap()
+	fetch := fmt.Sprintf(`FETCH FORWARD %d FROM movies_export`, batchSize)
+	for {
+		rows, err := tx.QueryContext(ctx, fetch)
+		if err != nil {
+			return err
+		}
+
+		fetched := 0
+		for rows.Next() {
+			var movie Movie
+			err := rows.Scan(
+				&movie.ID,
+				&movie.CreatedAt,
+				&movie.Title,
+				&movie.Year,
+				&movie.Runtime,
+				pgMap.SQLScanner(&movie.Genres),
+				&movie.Version,
+				&movie.Rating,
+				&movie.RatingCount,
+			)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			fetched++
+			if err = fn(&movie); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		if err = rows.Err(); err != nil {
+			rows.Close()
+			return err
+		}
+		rows.Close()
+
+		if fetched < batchSize {
+			break
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,191 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type Person struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Name      string    `json:"name"`
+	BirthDate *Date     `json:"birthDate,omitempty"`
+	Biography string    `json:"biography"`
+	Version   int32     `json:"version,omitempty"`
+}
+
+type PersonRepository interface {
+	Insert(person *Person) error
+	GetById(id int64) (*Person, error)
+	Get(filters PersonFilters) ([]*Person, Metadata, error)
+	Update(person *Person) error
+	Delete(id int64) error
+}
+
+type PersonFilters struct {
+	Name string `schema:"name"`
+	Filters
+}
+
+func NewPersonFilters() PersonFilters {
+	return PersonFilters{
+		Filters: Filters{
+			Page:         1,
+			PageSize:     20,
+			Sort:         "name",
+			SortSafelist: []string{"id", "-id", "name", "-name", "birth_date", "-birth_date"},
+		},
+	}
+}
+
+type PersonModel struct {
+	DB *sql.DB
+}
+
+func (m PersonModel) Insert(person *Person) error {
+	query := `INSERT INTO people (name, birth_date, biography) VALUES ($1, $2, $3)
+			RETURNING id, created_at, version`
+	args := []interface{}{person.Name, person.BirthDate, person.Biography}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&person.ID, &person.CreatedAt, &person.Version)
+}
+
+func (m PersonModel) GetById(id int64) (*Person, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_at, name, birth_date, biography, version FROM people
+		WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var person Person
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&person.ID,
+		&person.CreatedAt,
+		&person.Name,
+		&person.BirthDate,
+		&person.Biography,
+		&person.Version,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &person, nil
+}
+
+func (m PersonModel) Get(filters PersonFilters) ([]*Person, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, created_at, name, birth_date, biography, version
+		FROM people
+		WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		ORDER BY %s, id
+		LIMIT $2 OFFSET $3`, filters.getOrderBySpec())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.Name, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	people := []*Person{}
+	for rows.Next() {
+		var person Person
+		err := rows.Scan(
+			&totalRecords,
+			&person.ID,
+			&person.CreatedAt,
+			&person.Name,
+			&person.BirthDate,
+			&person.Biography,
+			&person.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		people = append(people, &person)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return people, calculateMetadata(filters.Page, filters.PageSize, totalRecords), nil
+}
+
+// touchCreditedMovies moves on every live movie crediting a person, whose
+// name is part of the movie representation.
+func touchCreditedMovies(ctx context.Context, tx *sql.Tx, personId int64) error {
+	_, err := touchMovies(ctx, tx, `id IN (SELECT movie_id FROM credits WHERE person_id = $1)`, personId)
+	return err
+}
+
+func (m PersonModel) Update(person *Person) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE people
+		SET name = $1, birth_date = $2, biography = $3, version = version + 1
+		WHERE id = $4 AND version = $5
+		RETURNING version`
+	args := []interface{}{person.Name, person.BirthDate, person.Biography, person.ID, person.Version}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&person.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+		return err
+	}
+
+	if err = touchCreditedMovies(ctx, tx, person.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m PersonModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The credits go with the person, so their movies change before they do.
+	if err = touchCreditedMovies(ctx, tx, id); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM people WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,134 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// MinScore and MaxScore bound a rating, as the CHECK constraint on
+// ratings.score does.
+const (
+	MinScore = 1
+	MaxScore = 10
+)
+
+type Rating struct {
+	UserID    int64     `json:"userId"`
+	MovieID   int64     `json:"movieId"`
+	Score     int16     `json:"score"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// RatingSummary is the aggregate kept on the movies row.
+type RatingSummary struct {
+	Rating      float64 `json:"rating"`
+	RatingCount int32   `json:"ratingCount"`
+}
+
+type RatingRepository interface {
+	Upsert(rating *Rating) (RatingSummary, error)
+	Delete(userId int64, movieId int64) (RatingSummary, error)
+}
+
+type RatingModel struct {
+	DB *sql.DB
+}
+
+// lockMovie takes a row lock on a live movie so concurrent rating changes on
+// the same movie recompute its aggregate one after another.
+func lockMovie(ctx context.Context, tx *sql.Tx, movieId int64) error {
+	query := `SELECT id FROM movies WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`
+	var id int64
+	err := tx.QueryRowContext(ctx, query, movieId).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// refreshRatingSummary recomputes the aggregate of a movie. The summary is
+// kept out of the versioned representation: ratings come from users, not
+// editors, so they neither move the version on, which would fail the
+// If-Match of every edit in progress, nor get revisions or events. Only
+// updated_at moves, keeping Last-Modified right.
+func refreshRatingSummary(ctx context.Context, tx *sql.Tx, movieId int64) (RatingSummary, error) {
+	query := `
+		UPDATE movies
+		SET rating = COALESCE((SELECT AVG(score) FROM ratings WHERE movie_id = $1), 0),
+		    rating_count = (SELECT COUNT(*) FROM ratings WHERE movie_id = $1),
+		    updated_at = NOW()
+		WHERE id = $1
+		RETURNING rating, rating_count`
+	var summary RatingSummary
+	err := tx.QueryRowContext(ctx, query, movieId).Scan(&summary.Rating, &summary.RatingCount)
+	return summary, err
+}
+
+func (m RatingModel) Upsert(rating *Rating) (RatingSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return RatingSummary{}, err
+	}
+	defer tx.Rollback()
+
+	if err = lockMovie(ctx, tx, rating.MovieID); err != nil {
+		return RatingSummary{}, err
+	}
+
+	query := `
+		INSERT INTO ratings (user_id, movie_id, score) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, movie_id) DO UPDATE SET score = EXCLUDED.score, updated_at = NOW()
+		RETURNING created_at, updated_at`
+	args := []interface{}{rating.UserID, rating.MovieID, rating.Score}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&rating.CreatedAt, &rating.UpdatedAt)
+	if err != nil {
+		return RatingSummary{}, err
+	}
+
+	summary, err := refreshRatingSummary(ctx, tx, rating.MovieID)
+	if err != nil {
+		return RatingSummary{}, err
+	}
+	return summary, tx.Commit()
+}
+
+func (m RatingModel) Delete(userId int64, movieId int64) (RatingSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return RatingSummary{}, err
+	}
+	defer tx.Rollback()
+
+	if err = lockMovie(ctx, tx, movieId); err != nil {
+		return RatingSummary{}, err
+	}
+
+	query := `DELETE FROM ratings WHERE user_id = $1 AND movie_id = $2`
+	result, err := tx.ExecContext(ctx, query, userId, movieId)
+	if err != nil {
+		return RatingSummary{}, err
+	}
+	rowAffected, err := result.RowsAffected()
+	if err != nil {
+		return RatingSummary{}, err
+	}
+	if rowAffected == 0 {
+		return RatingSummary{}, ErrRecordNotFound
+	}
+
+	summary, err := refreshRatingSummary(ctx, tx, movieId)
+	if err != nil {
+		return RatingSummary{}, err
+	}
+	return summary, tx.Commit()
+}
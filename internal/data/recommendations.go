@@ -0,0 +1,187 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgtype"
+	"time"
+)
+
+const (
+	RecommendationSourcePersonal = "personal"
+	RecommendationSourcePopular  = "popular"
+)
+
+type RecommendedMovie struct {
+	Score float64 `json:"score"`
+	*Movie
+}
+
+type RecommendationRepository interface {
+	ForUser(userId int64, filters Filters) ([]*RecommendedMovie, Metadata, string, error)
+	RefreshNeighbours(ctx context.Context, topN int, minCoRatings int) (int64, error)
+}
+
+type RecommendationModel struct {
+	DB *sql.DB
+}
+
+func NewRecommendationFilters() Filters {
+	return Filters{
+		Page:         1,
+		PageSize:     20,
+		Sort:         "-score",
+		SortSafelist: []string{"-score"},
+	}
+}
+
+// RefreshNeighbours rebuilds the top topN neighbours of every movie using the
+// adjusted cosine similarity of the ratings users gave both movies. Pairs
+// rated together by fewer than minCoRatings users are too noisy to keep.
+func (m RecommendationModel) RefreshNeighbours(ctx context.Context, topN int, minCoRatings int) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM movie_neighbours`)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+		WITH centered AS (
+			SELECT ratings.user_id, ratings.movie_id,
+			       ratings.score - AVG(ratings.score) OVER (PARTITION BY ratings.user_id) AS deviation
+			FROM ratings
+			INNER JOIN movies ON movies.id = ratings.movie_id AND movies.deleted_at IS NULL
+		), pairs AS (
+			SELECT a.movie_id, b.movie_id AS neighbour_id,
+			       SUM(a.deviation * b.deviation) /
+			       NULLIF(SQRT(SUM(a.deviation * a.deviation)) * SQRT(SUM(b.deviation * b.deviation)), 0) AS similarity,
+			       COUNT(*) AS co_ratings
+			FROM centered a
+			INNER JOIN centered b ON b.user_id = a.user_id AND b.movie_id <> a.movie_id
+			GROUP BY a.movie_id, b.movie_id
+			HAVING COUNT(*) >= $2
+		), ranked AS (
+			SELECT movie_id, neighbour_id, similarity, co_ratings,
+			       row_number() OVER (PARTITION BY movie_id ORDER BY similarity DESC, neighbour_id) AS rank
+			FROM pairs
+			WHERE similarity > 0
+		)
+		INSERT INTO movie_neighbours (movie_id, neighbour_id, similarity, co_ratings)
+		SELECT movie_id, neighbour_id, similarity, co_ratings FROM ranked WHERE rank <= $1`
+	result, err := tx.ExecContext(ctx, query, topN, minCoRatings)
+	if err != nil {
+		return 0, err
+	}
+	stored, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return stored, tx.Commit()
+}
+
+// scoreMidpoint splits ratings into those that speak for a movie's
+// neighbours and those that speak against them.
+const scoreMidpoint = (MinScore + MaxScore) / 2.0
+
+// personalCandidates scores the neighbours of the movies user $1 rated.
+var personalCandidates = fmt.Sprintf(`
+	SELECT movie_neighbours.neighbour_id AS movie_id,
+	       SUM(movie_neighbours.similarity * (ratings.score - %[1]v)) AS score
+	FROM ratings
+	INNER JOIN movie_neighbours ON movie_neighbours.movie_id = ratings.movie_id
+	WHERE ratings.user_id = $1
+	GROUP BY movie_neighbours.neighbour_id
+	HAVING SUM(movie_neighbours.similarity * (ratings.score - %[1]v)) > 0`, scoreMidpoint)
+
+// popularCandidates scores rated movies by their average, shrunk towards the
+// average of all ratings while they have few.
+const popularCandidates = `
+	SELECT movies.id AS movie_id,
+	       rating_count / (rating_count + 10.0) * rating
+	       + 10.0 / (rating_count + 10.0) * (SELECT COALESCE(AVG(score), 0) FROM ratings) AS score
+	FROM movies
+	WHERE deleted_at IS NULL AND rating_count > 0`
+
+// ForUser recommends live movies the user has not rated yet. Every movie the
+// user rated votes for its neighbours, weighted by similarity and by how far
+// the rating sits above or below the middle of the scale. Users left with no
+// personal recommendation get the most popular movies instead. The returned
+// source tells which of the two the list is.
+func (m RecommendationModel) ForUser(userId int64, filters Filters) ([]*RecommendedMovie, Metadata, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Ratings can reach neighbours that are all rated, trashed or voted
+	// down, so only an actual recommendation counts.
+	var personal bool
+	query := fmt.Sprintf(`
+		WITH candidates AS (%s)
+		SELECT EXISTS (
+			SELECT 1 FROM candidates
+			INNER JOIN movies ON movies.id = candidates.movie_id
+			WHERE movies.deleted_at IS NULL
+			AND movies.id NOT IN (SELECT movie_id FROM ratings WHERE user_id = $1))`, personalCandidates)
+	err := m.DB.QueryRowContext(ctx, query, userId).Scan(&personal)
+	if err != nil {
+		return nil, Metadata{}, "", err
+	}
+
+	source, candidates := RecommendationSourcePopular, popularCandidates
+	if personal {
+		source, candidates = RecommendationSourcePersonal, personalCandidates
+	}
+
+	query = fmt.Sprintf(`
+		WITH candidates AS (%s)
+		SELECT COUNT(*) OVER(), candidates.score,
+		       movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres,
+		       movies.version, movies.rating, movies.rating_count
+		FROM candidates
+		INNER JOIN movies ON movies.id = candidates.movie_id
+		WHERE movies.deleted_at IS NULL
+		AND movies.id NOT IN (SELECT movie_id FROM ratings WHERE user_id = $1)
+		ORDER BY %s, movies.id
+		LIMIT $2 OFFSET $3`, candidates, filters.getOrderBySpec())
+	rows, err := m.DB.QueryContext(ctx, query, userId, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, "", err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	recommended := []*RecommendedMovie{}
+	pgMap := pgtype.NewMap()
+	for rows.Next() {
+		movie := RecommendedMovie{Movie: &Movie{}}
+		err := rows.Scan(
+			&totalRecords,
+			&movie.Score,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pgMap.SQLScanner(&movie.Genres),
+			&movie.Version,
+			&movie.Rating,
+			&movie.RatingCount,
+		)
+		if err != nil {
+			return nil, Metadata{}, "", err
+		}
+		recommended = append(recommended, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, "", err
+	}
+
+	return recommended, calculateMetadata(filters.Page, filters.PageSize, totalRecords), source, nil
+}
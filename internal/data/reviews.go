@@ -0,0 +1,297 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	ReviewStatusPending  = "pending"
+	ReviewStatusApproved = "approved"
+	ReviewStatusHidden   = "hidden"
+	ReviewStatusRejected = "rejected"
+)
+
+var ErrDuplicateFlag = errors.New("duplicate flag")
+
+type Review struct {
+	ID             int64      `json:"id"`
+	MovieID        int64      `json:"movieId"`
+	UserID         int64      `json:"userId"`
+	Title          string     `json:"title"`
+	Body           string     `json:"body"`
+	Status         string     `json:"status"`
+	FlagCount      int32      `json:"flagCount"`
+	ModeratedBy    *int64     `json:"moderatedBy,omitempty"`
+	ModeratedAt    *time.Time `json:"moderatedAt,omitempty"`
+	ModerationNote string     `json:"moderationNote,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+	Version        int32      `json:"version"`
+}
+
+type ReviewRepository interface {
+	Insert(review *Review) error
+	GetById(id int64) (*Review, error)
+	GetAllForMovie(movieId int64, filters Filters) ([]*Review, Metadata, error)
+	GetModerationQueue(filters Filters) ([]*Review, Metadata, error)
+	Update(review *Review) error
+	Delete(id int64) error
+	Moderate(review *Review, moderatorId int64) error
+	Flag(reviewId int64, userId int64, reason string) error
+}
+
+type ReviewModel struct {
+	DB *sql.DB
+}
+
+func NewReviewFilters() Filters {
+	return Filters{
+		Page:         1,
+		PageSize:     20,
+		Sort:         "-created_at",
+		SortSafelist: []string{"id", "-id", "created_at", "-created_at", "flag_count", "-flag_count"},
+	}
+}
+
+const reviewColumns = `id, movie_id, user_id, title, body, status, flag_count, moderated_by, moderated_at,
+		moderation_note, created_at, updated_at, version`
+
+func scanReview(row scanner, dest ...any) (*Review, error) {
+	var review Review
+	dest = append(dest,
+		&review.ID,
+		&review.MovieID,
+		&review.UserID,
+		&review.Title,
+		&review.Body,
+		&review.Status,
+		&review.FlagCount,
+		&review.ModeratedBy,
+		&review.ModeratedAt,
+		&review.ModerationNote,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+		&review.Version,
+	)
+	err := row.Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+func (m ReviewModel) Insert(review *Review) error {
+	query := `
+		INSERT INTO reviews (movie_id, user_id, title, body)
+		SELECT $1, $2, $3, $4
+		WHERE EXISTS (SELECT 1 FROM movies WHERE id = $1 AND deleted_at IS NULL)
+		RETURNING id, status, created_at, updated_at, version`
+	args := []interface{}{review.MovieID, review.UserID, review.Title, review.Body}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&review.ID, &review.Status, &review.CreatedAt, &review.UpdatedAt, &review.Version,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (m ReviewModel) GetById(id int64) (*Review, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `SELECT ` + reviewColumns + ` FROM reviews WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	review, err := scanReview(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return review, nil
+}
+
+// GetAllForMovie lists the approved reviews of a movie.
+func (m ReviewModel) GetAllForMovie(movieId int64, filters Filters) ([]*Review, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), %s
+		FROM reviews
+		WHERE movie_id = $1 AND status = 'approved'
+		ORDER BY %s, id
+		LIMIT $2 OFFSET $3`, reviewColumns, filters.getOrderBySpec())
+	return m.list(query, filters, movieId, filters.limit(), filters.offset())
+}
+
+// GetModerationQueue lists reviews waiting for a first decision and approved
+// reviews that users have flagged since they were last moderated.
+func (m ReviewModel) GetModerationQueue(filters Filters) ([]*Review, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), %s
+		FROM reviews
+		WHERE status = 'pending' OR (status = 'approved' AND flag_count > 0)
+		ORDER BY %s, id
+		LIMIT $1 OFFSET $2`, reviewColumns, filters.getOrderBySpec())
+	return m.list(query, filters, filters.limit(), filters.offset())
+}
+
+func (m ReviewModel) list(query string, filters Filters, args ...any) ([]*Review, Metadata, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	reviews := []*Review{}
+	for rows.Next() {
+		review, err := scanReview(rows, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		reviews = append(reviews, review)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return reviews, calculateMetadata(filters.Page, filters.PageSize, totalRecords), nil
+}
+
+// Update saves an edit by the author. Edited reviews go back through
+// moderation and start with a clean flag count.
+func (m ReviewModel) Update(review *Review) error {
+	query := `
+		UPDATE reviews
+		SET title = $1, body = $2, status = 'pending', flag_count = 0, updated_at = NOW(), version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING status, flag_count, updated_at, version`
+	args := []interface{}{review.Title, review.Body, review.ID, review.Version}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&review.Status, &review.FlagCount, &review.UpdatedAt, &review.Version,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+		return err
+	}
+	return nil
+}
+
+func (m ReviewModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `DELETE FROM reviews WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Moderate records a moderator decision. Any outstanding flags are considered
+// handled by the decision and cleared.
+func (m ReviewModel) Moderate(review *Review, moderatorId int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE reviews
+		SET status = $1, moderation_note = $2, moderated_by = $3, moderated_at = NOW(), flag_count = 0,
+		    version = version + 1
+		WHERE id = $4 AND version = $5
+		RETURNING moderated_by, moderated_at, flag_count, version`
+	args := []interface{}{review.Status, review.ModerationNote, moderatorId, review.ID, review.Version}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(
+		&review.ModeratedBy, &review.ModeratedAt, &review.FlagCount, &review.Version,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM review_flags WHERE review_id = $1`, review.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Flag records that a user reported a review. Each user can flag a review once
+// per moderation round.
+func (m ReviewModel) Flag(reviewId int64, userId int64, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Counting first locks the review, so it cannot be hidden between the
+	// status check and the flag.
+	query := `UPDATE reviews SET flag_count = flag_count + 1 WHERE id = $1 AND status = 'approved'`
+	result, err := tx.ExecContext(ctx, query, reviewId)
+	if err != nil {
+		return err
+	}
+	rowAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	query = `
+		INSERT INTO review_flags (review_id, user_id, reason) VALUES ($1, $2, $3)
+		ON CONFLICT (review_id, user_id) DO NOTHING`
+	result, err = tx.ExecContext(ctx, query, reviewId, userId, reason)
+	if err != nil {
+		return err
+	}
+	rowAffected, err = result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowAffected == 0 {
+		return ErrDuplicateFlag
+	}
+	return tx.Commit()
+}
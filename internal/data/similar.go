@@ -0,0 +1,84 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgtype"
+	"time"
+)
+
+// SimilarityWeights sets how much each component of the precomputed
+// similarity counts towards a movie's score.
+type SimilarityWeights struct {
+	Genres float64
+	Year   float64
+	People float64
+	Title  float64
+}
+
+type SimilarMovie struct {
+	Score float64 `json:"score"`
+	*Movie
+}
+
+func NewSimilarFilters() Filters {
+	return Filters{
+		Page:         1,
+		PageSize:     20,
+		Sort:         "-score",
+		SortSafelist: []string{"score", "-score"},
+	}
+}
+
+// GetSimilar ranks the live movies most like movie id using the scores
+// precomputed by the scheduled materialized view refresh.
+func (m MovieModel) GetSimilar(id int64, weights SimilarityWeights, filters Filters) ([]*SimilarMovie, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(),
+		       genre_score * $2 + year_score * $3 + people_score * $4 + title_score * $5 AS score,
+		       movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres,
+		       movies.version, movies.rating, movies.rating_count
+		FROM movie_similarities
+		INNER JOIN movies ON movies.id = movie_similarities.similar_id
+		WHERE movie_similarities.movie_id = $1 AND movies.deleted_at IS NULL
+		ORDER BY %s, movies.id
+		LIMIT $6 OFFSET $7`, filters.getOrderBySpec())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{id, weights.Genres, weights.Year, weights.People, weights.Title, filters.limit(), filters.offset()}
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	similar := []*SimilarMovie{}
+	pgMap := pgtype.NewMap()
+	for rows.Next() {
+		movie := SimilarMovie{Movie: &Movie{}}
+		err := rows.Scan(
+			&totalRecords,
+			&movie.Score,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pgMap.SQLScanner(&movie.Genres),
+			&movie.Version,
+			&movie.Rating,
+			&movie.RatingCount,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		similar = append(similar, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return similar, calculateMetadata(filters.Page, filters.PageSize, totalRecords), nil
+}
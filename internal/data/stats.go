@@ -0,0 +1,186 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgtype"
+	"time"
+)
+
+// StatsWindows are the periods trending movies and statistics can cover.
+var StatsWindows = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+// MovieCounts are the events collected for one movie.
+type MovieCounts struct {
+	Views      int64 `json:"views"`
+	SearchHits int64 `json:"searchHits"`
+}
+
+type TrendingMovie struct {
+	MovieCounts
+	*Movie
+}
+
+type StatsBucket struct {
+	Start time.Time `json:"start"`
+	MovieCounts
+}
+
+type MovieStats struct {
+	MovieID int64          `json:"movieId"`
+	Window  string         `json:"window"`
+	Totals  MovieCounts    `json:"totals"`
+	Buckets []*StatsBucket `json:"buckets"`
+}
+
+type TrendingFilters struct {
+	Window string `schema:"window" validate:"oneof=24h 7d 30d"`
+	Filters
+}
+
+func NewTrendingFilters() TrendingFilters {
+	return TrendingFilters{
+		Window: "24h",
+		Filters: Filters{
+			Page:         1,
+			PageSize:     20,
+			Sort:         "-views",
+			SortSafelist: []string{"views", "-views", "search_hits", "-search_hits"},
+		},
+	}
+}
+
+type StatsRepository interface {
+	Add(bucket time.Time, counts map[int64]*MovieCounts) error
+	GetTrending(filters TrendingFilters) ([]*TrendingMovie, Metadata, error)
+	GetForMovie(movieId int64, window string, interval string) (*MovieStats, error)
+}
+
+type StatsModel struct {
+	DB *sql.DB
+}
+
+// Add folds a batch of counts into the hourly bucket containing bucket.
+// Counts for movies that no longer exist are dropped.
+func (m StatsModel) Add(bucket time.Time, counts map[int64]*MovieCounts) error {
+	if len(counts) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(counts))
+	views := make([]int64, 0, len(counts))
+	searchHits := make([]int64, 0, len(counts))
+	for id, c := range counts {
+		ids = append(ids, id)
+		views = append(views, c.Views)
+		searchHits = append(searchHits, c.SearchHits)
+	}
+
+	query := `
+		INSERT INTO movie_stats (movie_id, bucket, views, search_hits)
+		SELECT counts.movie_id, date_trunc('hour', $1::timestamptz), counts.views, counts.search_hits
+		FROM unnest($2::bigint[], $3::bigint[], $4::bigint[]) AS counts (movie_id, views, search_hits)
+		INNER JOIN movies ON movies.id = counts.movie_id
+		ON CONFLICT (movie_id, bucket) DO UPDATE
+		SET views = movie_stats.views + EXCLUDED.views, search_hits = movie_stats.search_hits + EXCLUDED.search_hits`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, bucket, ids, views, searchHits)
+	return err
+}
+
+func (m StatsModel) GetTrending(filters TrendingFilters) ([]*TrendingMovie, Metadata, error) {
+	query := fmt.Sprintf(`
+		WITH counts AS (
+			SELECT movie_id, SUM(views) AS views, SUM(search_hits) AS search_hits
+			FROM movie_stats
+			WHERE bucket >= $1
+			GROUP BY movie_id
+		)
+		SELECT COUNT(*) OVER(), counts.views, counts.search_hits,
+		       movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres,
+		       movies.version, movies.rating, movies.rating_count
+		FROM counts
+		INNER JOIN movies ON movies.id = counts.movie_id
+		WHERE movies.deleted_at IS NULL
+		ORDER BY %s, movies.id
+		LIMIT $2 OFFSET $3`, filters.getOrderBySpec())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	since := time.Now().Add(-StatsWindows[filters.Window])
+	rows, err := m.DB.QueryContext(ctx, query, since, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	trending := []*TrendingMovie{}
+	pgMap := pgtype.NewMap()
+	for rows.Next() {
+		movie := TrendingMovie{Movie: &Movie{}}
+		err := rows.Scan(
+			&totalRecords,
+			&movie.Views,
+			&movie.SearchHits,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pgMap.SQLScanner(&movie.Genres),
+			&movie.Version,
+			&movie.Rating,
+			&movie.RatingCount,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		trending = append(trending, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return trending, calculateMetadata(filters.Page, filters.PageSize, totalRecords), nil
+}
+
+// GetForMovie sums a movie's counters over window, grouped per hour or day.
+func (m StatsModel) GetForMovie(movieId int64, window string, interval string) (*MovieStats, error) {
+	query := `
+		SELECT date_trunc($3, bucket) AS start, SUM(views), SUM(search_hits)
+		FROM movie_stats
+		WHERE movie_id = $1 AND bucket >= $2
+		GROUP BY start
+		ORDER BY start`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	since := time.Now().Add(-StatsWindows[window])
+	rows, err := m.DB.QueryContext(ctx, query, movieId, since, interval)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := &MovieStats{MovieID: movieId, Window: window, Buckets: []*StatsBucket{}}
+	for rows.Next() {
+		var bucket StatsBucket
+		if err = rows.Scan(&bucket.Start, &bucket.Views, &bucket.SearchHits); err != nil {
+			return nil, err
+		}
+		stats.Totals.Views += bucket.Views
+		stats.Totals.SearchHits += bucket.SearchHits
+		stats.Buckets = append(stats.Buckets, &bucket)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
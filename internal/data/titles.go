@@ -0,0 +1,194 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/text/language"
+	"time"
+)
+
+var ErrDuplicateTitle = errors.New("duplicate title")
+
+// searchConfigs maps a language subtag to the Postgres text search
+// configuration that stems it. Anything else is searched with 'simple'.
+var searchConfigs = map[string]string{
+	"ar": "arabic",
+	"da": "danish",
+	"de": "german",
+	"el": "greek",
+	"en": "english",
+	"es": "spanish",
+	"fi": "finnish",
+	"fr": "french",
+	"ga": "irish",
+	"hu": "hungarian",
+	"id": "indonesian",
+	"it": "italian",
+	"lt": "lithuanian",
+	"nb": "norwegian",
+	"ne": "nepali",
+	"nl": "dutch",
+	"no": "norwegian",
+	"pt": "portuguese",
+	"ro": "romanian",
+	"ru": "russian",
+	"sv": "swedish",
+	"ta": "tamil",
+	"tr": "turkish",
+}
+
+// searchConfig returns the text search configuration for a BCP-47 locale.
+func searchConfig(locale string) string {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return "simple"
+	}
+	base, _ := tag.Base()
+	if config, ok := searchConfigs[base.String()]; ok {
+		return config
+	}
+	return "simple"
+}
+
+// CanonicalLocale normalises a BCP-47 tag, so en-us and en-US are stored and
+// matched as the same locale.
+func CanonicalLocale(locale string) (string, error) {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return "", err
+	}
+	return tag.String(), nil
+}
+
+type MovieTitle struct {
+	Locale    string `json:"locale"`
+	Title     string `json:"title"`
+	Alternate bool   `json:"alternate"`
+}
+
+type MovieTitleRepository interface {
+	GetAllForMovie(movieId int64) ([]*MovieTitle, error)
+	Set(movieId int64, titles []*MovieTitle) error
+	Localize(movies []*Movie, locales []string) error
+}
+
+type MovieTitleModel struct {
+	DB *sql.DB
+}
+
+func (m MovieTitleModel) GetAllForMovie(movieId int64) ([]*MovieTitle, error) {
+	query := `
+		SELECT locale, title, alternate FROM movie_titles
+		WHERE movie_id = $1
+		ORDER BY locale, alternate, title`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	titles := []*MovieTitle{}
+	for rows.Next() {
+		var title MovieTitle
+		if err = rows.Scan(&title.Locale, &title.Title, &title.Alternate); err != nil {
+			return nil, err
+		}
+		titles = append(titles, &title)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return titles, nil
+}
+
+// Set replaces all localised titles of a live movie and moves the movie on to
+// a new version. Locales are expected in canonical form.
+func (m MovieTitleModel) Set(movieId int64, titles []*MovieTitle) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = touchMovie(ctx, tx, movieId); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM movie_titles WHERE movie_id = $1`, movieId)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO movie_titles (movie_id, locale, title, alternate, search_config)
+		VALUES ($1, $2, $3, $4, $5::regconfig)`
+	for _, title := range titles {
+		args := []interface{}{movieId, title.Locale, title.Title, title.Alternate, searchConfig(title.Locale)}
+		_, err = tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+				return ErrDuplicateTitle
+			}
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Localize replaces the title of each movie with its display title in the
+// first of locales that has one, keeping the original in OriginalTitle.
+// Movies without a matching title are left as they are.
+func (m MovieTitleModel) Localize(movies []*Movie, locales []string) error {
+	if len(movies) == 0 || len(locales) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+
+	query := `
+		SELECT DISTINCT ON (movie_id) movie_id, locale, title FROM movie_titles
+		WHERE movie_id = ANY($1) AND locale = ANY($2) AND NOT alternate
+		ORDER BY movie_id, array_position($2, locale)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, ids, locales)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	localized := map[int64]MovieTitle{}
+	for rows.Next() {
+		var movieId int64
+		var title MovieTitle
+		if err = rows.Scan(&movieId, &title.Locale, &title.Title); err != nil {
+			return err
+		}
+		localized[movieId] = title
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, movie := range movies {
+		title, ok := localized[movie.ID]
+		if !ok {
+			continue
+		}
+		movie.OriginalTitle = movie.Title
+		movie.Title = title.Title
+		movie.TitleLocale = title.Locale
+	}
+	return nil
+}
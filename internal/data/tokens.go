@@ -87,4 +87,16 @@ func (t TokenModel) DeleteAllForUser(userId int64, scope string) error {
 type TokenRepository interface {
 	New(userId int64, ttl time.Duration, scope string) (*Token, error)
 	DeleteAllForUser(userId int64, scope string) error
+	DeleteExpired() (int64, error)
+}
+
+// DeleteExpired removes tokens past their expiry, which can no longer be used.
+func (t TokenModel) DeleteExpired() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	result, err := t.DB.ExecContext(ctx, `DELETE FROM tokens WHERE expiry < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
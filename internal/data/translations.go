@@ -0,0 +1,131 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// MovieTranslation holds the descriptive text of a movie in one locale.
+type MovieTranslation struct {
+	Locale   string `json:"locale"`
+	Tagline  string `json:"tagline,omitempty"`
+	Overview string `json:"overview,omitempty"`
+}
+
+type MovieTranslationRepository interface {
+	GetAllForMovie(movieId int64) ([]*MovieTranslation, error)
+	Set(movieId int64, translations []*MovieTranslation) error
+	Localize(movies []*Movie, locales []string) error
+}
+
+type MovieTranslationModel struct {
+	DB *sql.DB
+}
+
+func (m MovieTranslationModel) GetAllForMovie(movieId int64) ([]*MovieTranslation, error) {
+	query := `
+		SELECT locale, tagline, overview FROM movie_translations
+		WHERE movie_id = $1
+		ORDER BY locale`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	translations := []*MovieTranslation{}
+	for rows.Next() {
+		var translation MovieTranslation
+		if err = rows.Scan(&translation.Locale, &translation.Tagline, &translation.Overview); err != nil {
+			return nil, err
+		}
+		translations = append(translations, &translation)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return translations, nil
+}
+
+// Set replaces all translations of a live movie and moves the movie on to a
+// new version. Locales are expected in canonical form and to be unique.
+func (m MovieTranslationModel) Set(movieId int64, translations []*MovieTranslation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = touchMovie(ctx, tx, movieId); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM movie_translations WHERE movie_id = $1`, movieId)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO movie_translations (movie_id, locale, tagline, overview) VALUES ($1, $2, $3, $4)`
+	for _, translation := range translations {
+		_, err = tx.ExecContext(ctx, query, movieId, translation.Locale, translation.Tagline, translation.Overview)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Localize fills in the tagline and overview of each movie from the first of
+// locales it has a translation for. Movies without one are left as they are.
+func (m MovieTranslationModel) Localize(movies []*Movie, locales []string) error {
+	if len(movies) == 0 || len(locales) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+
+	query := `
+		SELECT DISTINCT ON (movie_id) movie_id, locale, tagline, overview FROM movie_translations
+		WHERE movie_id = ANY($1) AND locale = ANY($2)
+		ORDER BY movie_id, array_position($2, locale)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, ids, locales)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	localized := map[int64]MovieTranslation{}
+	for rows.Next() {
+		var movieId int64
+		var translation MovieTranslation
+		if err = rows.Scan(&movieId, &translation.Locale, &translation.Tagline, &translation.Overview); err != nil {
+			return err
+		}
+		localized[movieId] = translation
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, movie := range movies {
+		translation, ok := localized[movie.ID]
+		if !ok {
+			continue
+		}
+		movie.Tagline = translation.Tagline
+		movie.Overview = translation.Overview
+		movie.TranslationLocale = translation.Locale
+	}
+	return nil
+}
@@ -21,6 +21,7 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
+	Locale    string    `json:"locale"`
 	Version   int       `json:"-"`
 }
 
@@ -65,24 +66,31 @@ type UserModel struct {
 }
 
 type UserRepository interface {
-	Insert(user *User) error
+	Insert(user *User, followUp func(user *User) ([]*Job, error)) error
 	GetById(id int64) (*User, error)
 	GetByEmail(email string) (*User, error)
 	Update(user *User) error
 	GetByToken(scope string, plainToken string) (*User, error)
 	ActivateUser(userId int64, version int) error
+	DeleteUnactivated(olderThan time.Duration) (int64, error)
 }
 
-func (m UserModel) Insert(user *User) error {
-	query := `
-		INSERT INTO users (name, email, password_hash, activated) VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at, version`
-
-	args := []interface{}{user.Name, user.Email, user.Password.hash, user.Activated}
+// Insert creates user and, in the same transaction, queues the jobs
+// followUp returns for it, so that a new user never goes without them.
+func (m UserModel) Insert(user *User, followUp func(user *User) ([]*Job, error)) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	query := `
+		INSERT INTO users (name, email, password_hash, activated, locale) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, version`
+	args := []interface{}{user.Name, user.Email, user.Password.hash, user.Activated, user.Locale}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "users_email_key" {
@@ -90,18 +98,30 @@ func (m UserModel) Insert(user *User) error {
 		}
 		return err
 	}
-	return nil
+
+	if followUp != nil {
+		jobs, err := followUp(user)
+		if err != nil {
+			return err
+		}
+		for _, job := range jobs {
+			if err = insertJob(ctx, tx, job); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
 }
 
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-		SELECT id, created_at, name, email, password_hash, activated, version FROM users
+		SELECT id, created_at, name, email, password_hash, activated, locale, version FROM users
 		WHERE email = $1`
 	var user User
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	err := m.DB.QueryRowContext(ctx, query, email).Scan(&user.ID,
-		&user.CreatedAt, &user.Name, &user.Email, &user.Password.hash, &user.Activated, &user.Version,
+		&user.CreatedAt, &user.Name, &user.Email, &user.Password.hash, &user.Activated, &user.Locale, &user.Version,
 	)
 	if err != nil {
 		switch {
@@ -116,13 +136,13 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 
 func (m UserModel) GetById(id int64) (*User, error) {
 	query := `
-		SELECT id, created_at, name, email, password_hash, activated, version FROM users
+		SELECT id, created_at, name, email, password_hash, activated, locale, version FROM users
 		WHERE id = $1`
 	var user User
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(&user.ID,
-		&user.CreatedAt, &user.Name, &user.Email, &user.Password.hash, &user.Activated, &user.Version,
+		&user.CreatedAt, &user.Name, &user.Email, &user.Password.hash, &user.Activated, &user.Locale, &user.Version,
 	)
 	if err != nil {
 		switch {
@@ -137,13 +157,14 @@ func (m UserModel) GetById(id int64) (*User, error) {
 
 func (m UserModel) Update(user *User) error {
 	query := ` UPDATE users
-		SET name = $1, password_hash = $2, activated = $3, version = version + 1 
-		WHERE id = $4 AND version = $5
+		SET name = $1, password_hash = $2, activated = $3, locale = $4, version = version + 1 
+		WHERE id = $5 AND version = $6
 		RETURNING version`
 	args := []interface{}{
 		user.Name,
 		user.Password.hash,
 		user.Activated,
+		user.Locale,
 		user.ID,
 		user.Version,
 	}
@@ -174,7 +195,7 @@ func (m UserModel) ActivateUser(userId int64, version int) error {
 
 func (m UserModel) GetByToken(scope string, plainToken string) (*User, error) {
 	hash := sha256.Sum256([]byte(plainToken))
-	query := `SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version FROM users
+	query := `SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.locale, users.version FROM users
 				INNER JOIN tokens ON users.id = tokens.user_id
 				WHERE tokens.hash = $1 AND tokens.scope = $2 AND tokens.expiry > $3`
 
@@ -189,6 +210,7 @@ func (m UserModel) GetByToken(scope string, plainToken string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Locale,
 		&user.Version,
 	)
 	if err != nil {
@@ -200,3 +222,19 @@ func (m UserModel) GetByToken(scope string, plainToken string) (*User, error) {
 
 	return &user, nil
 }
+
+// DeleteUnactivated removes accounts that were never activated within
+// olderThan of signing up, freeing their email addresses.
+func (m UserModel) DeleteUnactivated(olderThan time.Duration) (int64, error) {
+	query := `
+		DELETE FROM users
+		WHERE NOT activated AND created_at < $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, time.Now().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
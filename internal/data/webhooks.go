@@ -0,0 +1,374 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgtype"
+	"time"
+)
+
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusFailed    = "failed"
+	DeliveryStatusSucceeded = "succeeded"
+	DeliveryStatusDead      = "dead"
+)
+
+type Webhook struct {
+	ID        int64     `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"createdAt"`
+	Version   int32     `json:"version"`
+}
+
+type WebhookDelivery struct {
+	ID             int64      `json:"id"`
+	WebhookID      int64      `json:"webhookId"`
+	EventID        int64      `json:"eventId"`
+	EventType      string     `json:"eventType"`
+	Status         string     `json:"status"`
+	Attempts       int32      `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"nextAttemptAt"`
+	LastAttemptAt  *time.Time `json:"lastAttemptAt"`
+	ResponseStatus *int32     `json:"responseStatus"`
+	LastError      string     `json:"lastError"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+// DueDelivery carries everything needed to send one delivery.
+type DueDelivery struct {
+	WebhookDelivery
+	URL    string
+	Secret string
+	Event  MovieEvent
+	// LeaseToken identifies the claim; the outcome is only recorded under it.
+	LeaseToken string
+}
+
+type DeliveryFilters struct {
+	Status string `schema:"status" validate:"omitempty,oneof=pending failed succeeded dead"`
+	Filters
+}
+
+func NewDeliveryFilters() DeliveryFilters {
+	return DeliveryFilters{
+		Filters: Filters{
+			Page:         1,
+			PageSize:     20,
+			Sort:         "-id",
+			SortSafelist: []string{"id", "-id", "next_attempt_at", "-next_attempt_at"},
+		},
+	}
+}
+
+type WebhookRepository interface {
+	Insert(webhook *Webhook) error
+	GetAll() ([]*Webhook, error)
+	GetById(id int64) (*Webhook, error)
+	Update(webhook *Webhook) error
+	Delete(id int64) error
+	GetDeliveries(webhookId int64, filters DeliveryFilters) ([]*WebhookDelivery, Metadata, error)
+	Redeliver(webhookId int64, deliveryId int64) (*WebhookDelivery, error)
+	ClaimDue(limit int, lease time.Duration) ([]*DueDelivery, error)
+	CompleteDelivery(id int64, leaseToken string, responseStatus int, deliveryErr error, retry time.Duration, maxAttempts int) error
+}
+
+type WebhookModel struct {
+	DB *sql.DB
+}
+
+const webhookColumns = `id, url, secret, events, active, created_at, version`
+
+func scanWebhook(row scanner, webhook *Webhook) error {
+	return row.Scan(
+		&webhook.ID,
+		&webhook.URL,
+		&webhook.Secret,
+		pgtype.NewMap().SQLScanner(&webhook.Events),
+		&webhook.Active,
+		&webhook.CreatedAt,
+		&webhook.Version,
+	)
+}
+
+func (m WebhookModel) Insert(webhook *Webhook) error {
+	query := `
+		INSERT INTO webhooks (url, secret, events, active) VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, version`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{webhook.URL, webhook.Secret, webhook.Events, webhook.Active}
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.ID, &webhook.CreatedAt, &webhook.Version)
+}
+
+func (m WebhookModel) GetAll() ([]*Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks ORDER BY id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		var webhook Webhook
+		if err = scanWebhook(rows, &webhook); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (m WebhookModel) GetById(id int64) (*Webhook, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var webhook Webhook
+	err := scanWebhook(m.DB.QueryRowContext(ctx, query, id), &webhook)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (m WebhookModel) Update(webhook *Webhook) error {
+	query := `
+		UPDATE webhooks
+		SET url = $1, events = $2, active = $3, version = version + 1
+		WHERE id = $4 AND version = $5
+		RETURNING version`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{webhook.URL, webhook.Events, webhook.Active, webhook.ID, webhook.Version}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+		return err
+	}
+	return nil
+}
+
+func (m WebhookModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+const deliveryColumns = `webhook_deliveries.id, webhook_id, event_id, movie_events.type, status, attempts,
+	next_attempt_at, last_attempt_at, response_status, last_error, webhook_deliveries.created_at`
+
+func deliveryDest(delivery *WebhookDelivery) []any {
+	return []any{
+		&delivery.ID,
+		&delivery.WebhookID,
+		&delivery.EventID,
+		&delivery.EventType,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.LastAttemptAt,
+		&delivery.ResponseStatus,
+		&delivery.LastError,
+		&delivery.CreatedAt,
+	}
+}
+
+// GetDeliveries pages through the delivery log of a webhook.
+func (m WebhookModel) GetDeliveries(webhookId int64, filters DeliveryFilters) ([]*WebhookDelivery, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), %s
+		FROM webhook_deliveries
+		INNER JOIN movie_events ON movie_events.id = webhook_deliveries.event_id
+		WHERE webhook_id = $1 AND (status = $2 OR $2 = '')
+		ORDER BY webhook_deliveries.%s, webhook_deliveries.id
+		LIMIT $3 OFFSET $4`, deliveryColumns, filters.getOrderBySpec())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, webhookId, filters.Status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		err = rows.Scan(append([]any{&totalRecords}, deliveryDest(&delivery)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return deliveries, calculateMetadata(filters.Page, filters.PageSize, totalRecords), nil
+}
+
+// Redeliver queues a delivery for immediate sending with a fresh set of
+// attempts, whatever state it ended up in.
+func (m WebhookModel) Redeliver(webhookId int64, deliveryId int64) (*WebhookDelivery, error) {
+	query := fmt.Sprintf(`
+		WITH redelivered AS (
+			UPDATE webhook_deliveries
+			SET status = 'pending', attempts = 0, next_attempt_at = NOW(), lease_token = NULL
+			WHERE id = $1 AND webhook_id = $2
+			RETURNING *
+		)
+		SELECT %s FROM redelivered webhook_deliveries
+		INNER JOIN movie_events ON movie_events.id = webhook_deliveries.event_id`, deliveryColumns)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var delivery WebhookDelivery
+	err := m.DB.QueryRowContext(ctx, query, deliveryId, webhookId).Scan(deliveryDest(&delivery)...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// ClaimDue picks up to limit due deliveries of active webhooks and leases
+// them for lease, so concurrent dispatchers skip them while they are being
+// sent. A dispatcher that dies mid send lets the lease run out and the
+// delivery is retried. The lease has to cover sending every claimed
+// delivery.
+func (m WebhookModel) ClaimDue(limit int, lease time.Duration) ([]*DueDelivery, error) {
+	token, err := newLeaseToken()
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf(`
+		WITH claimed AS (
+			UPDATE webhook_deliveries
+			SET next_attempt_at = NOW() + $2 * interval '1 second', lease_token = $3
+			WHERE id IN (
+				SELECT id FROM webhook_deliveries
+				WHERE status IN ('pending', 'failed') AND next_attempt_at <= NOW()
+				AND webhook_id IN (SELECT id FROM webhooks WHERE active)
+				ORDER BY next_attempt_at
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *
+		)
+		SELECT %s, webhooks.url, webhooks.secret,
+		       movie_events.id, movie_events.movie_id, movie_events.payload, movie_events.created_at
+		FROM claimed webhook_deliveries
+		INNER JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id
+		INNER JOIN movie_events ON movie_events.id = webhook_deliveries.event_id`, deliveryColumns)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, lease.Seconds(), token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	due := []*DueDelivery{}
+	for rows.Next() {
+		delivery := DueDelivery{LeaseToken: token}
+		var payload []byte
+		dest := append(deliveryDest(&delivery.WebhookDelivery),
+			&delivery.URL,
+			&delivery.Secret,
+			&delivery.Event.ID,
+			&delivery.Event.MovieID,
+			&payload,
+			&delivery.Event.CreatedAt,
+		)
+		if err = rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		delivery.Event.Type = delivery.EventType
+		delivery.Event.Payload = json.RawMessage(payload)
+		due = append(due, &delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return due, nil
+}
+
+// CompleteDelivery records the outcome of an attempt made under the claim
+// leaseToken. A failed attempt is retried after retry, unless it was the
+// last of maxAttempts, in which case the delivery is dead until someone
+// redelivers it. It returns ErrLeaseLost when the claim is no longer held.
+func (m WebhookModel) CompleteDelivery(id int64, leaseToken string, responseStatus int, deliveryErr error, retry time.Duration, maxAttempts int) error {
+	var status *int
+	if responseStatus != 0 {
+		status = &responseStatus
+	}
+	lastError := ""
+	if deliveryErr != nil {
+		lastError = deliveryErr.Error()
+	}
+
+	query := `
+		UPDATE webhook_deliveries
+		SET attempts = attempts + 1,
+		    last_attempt_at = NOW(),
+		    response_status = $2,
+		    last_error = $3,
+		    status = CASE
+		        WHEN $3 = '' THEN 'succeeded'
+		        WHEN attempts + 1 >= $5 THEN 'dead'
+		        ELSE 'failed' END,
+		    next_attempt_at = NOW() + $4 * interval '1 second',
+		    lease_token = NULL
+		WHERE id = $1 AND lease_token = $6`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, status, lastError, retry.Seconds(), maxAttempts, leaseToken)
+	if err != nil {
+		return err
+	}
+	return checkLease(result)
+}
@@ -0,0 +1,97 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"openmovies/internal/data"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Writer encodes movies one at a time onto an underlying stream.
+type Writer interface {
+	Write(movie *data.Movie) error
+	Flush() error
+}
+
+// Supported reports whether format names an export format.
+func Supported(format string) bool {
+	return format == FormatCSV || format == FormatJSONL
+}
+
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatJSONL:
+		return &jsonlWriter{encoder: json.NewEncoder(w)}, nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// ContentType returns the media type advertised for an export format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatJSONL:
+		return "application/x-ndjson"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{"id", "created_at", "title", "year", "runtime", "genres", "version", "rating", "rating_count"})
+	if err != nil {
+		return nil, err
+	}
+	return &csvWriter{writer: writer}, nil
+}
+
+func (c *csvWriter) Write(movie *data.Movie) error {
+	return c.writer.Write([]string{
+		strconv.FormatInt(movie.ID, 10),
+		movie.CreatedAt.UTC().Format(time.RFC3339),
+		movie.Title,
+		strconv.Itoa(int(movie.Year)),
+		strconv.Itoa(int(movie.Runtime)),
+		strings.Join(movie.Genres, "|"),
+		strconv.Itoa(int(movie.Version)),
+		strconv.FormatFloat(movie.Rating, 'f', 2, 64),
+		strconv.Itoa(int(movie.RatingCount)),
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+type jsonlWriter struct {
+	encoder *json.Encoder
+}
+
+func (j *jsonlWriter) Write(movie *data.Movie) error {
+	return j.encoder.Encode(movie)
+}
+
+func (j *jsonlWriter) Flush() error {
+	return nil
+}
@@ -0,0 +1,112 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+)
+
+var ErrTooLarge = errors.New("image dimensions too large")
+
+// MaxPixels bounds the decoded size of an upload, so a small, highly
+// compressed file cannot make the server allocate gigabytes. Decoding and
+// converting an image of this size to RGBA takes about 100MB each.
+const MaxPixels = 25_000_000
+
+// Variant is a resized rendition kept next to every original.
+type Variant struct {
+	Name  string
+	Width int
+}
+
+var Variants = []Variant{
+	{Name: "small", Width: 185},
+	{Name: "medium", Width: 500},
+	{Name: "large", Width: 1280},
+}
+
+// Decode checks the dimensions announced by the image header before
+// decoding the pixels.
+func Decode(src []byte) (image.Image, string, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(src))
+	if err != nil {
+		return nil, "", err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width > MaxPixels/config.Height {
+		return nil, "", ErrTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(src))
+	if err != nil {
+		return nil, "", err
+	}
+	return img, format, nil
+}
+
+// ToRGBA returns img as an *image.RGBA anchored at the origin, converting it
+// only when it is not one already.
+func ToRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// Resize scales img down to width, keeping its aspect ratio, by averaging
+// every source pixel that falls into a destination pixel. Images already
+// narrower than width are returned as they are. Passing the result of
+// ToRGBA saves converting the source on every call.
+func Resize(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= width {
+		return img
+	}
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	src := ToRGBA(img)
+	bounds = src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := y * bounds.Dy() / height
+		y1 := max((y+1)*bounds.Dy()/height, y0+1)
+		for x := 0; x < width; x++ {
+			x0 := x * bounds.Dx() / width
+			x1 := max((x+1)*bounds.Dx()/width, x0+1)
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				offset := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(src.Pix[offset])
+					g += uint32(src.Pix[offset+1])
+					b += uint32(src.Pix[offset+2])
+					a += uint32(src.Pix[offset+3])
+					offset += 4
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: uint8(a / n)})
+		}
+	}
+	return dst
+}
+
+// EncodeJPEG writes img as a JPEG, flattening any transparency onto white.
+func EncodeJPEG(w io.Writer, img image.Image) error {
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+	return jpeg.Encode(w, flat, &jpeg.Options{Quality: 85})
+}
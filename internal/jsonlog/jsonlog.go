@@ -13,7 +13,8 @@ import (
 type Level int8
 
 const (
-	LevelInfo Level = iota
+	LevelDebug Level = iota
+	LevelInfo
 	LevelError
 	LevelFatal
 	LevelOff
@@ -21,6 +22,8 @@ const (
 
 func (l Level) String() string {
 	switch l {
+	case LevelDebug:
+		return "DEBUG"
 	case LevelInfo:
 		return "INFO"
 	case LevelError:
@@ -46,6 +49,10 @@ func New(out io.Writer, minLevel Level) *Logger {
 	}
 }
 
+func (l *Logger) LogDebug(message string, properties map[string]string) {
+	l.log(LevelDebug, message, properties)
+}
+
 func (l *Logger) LogInfo(message string, properties map[string]string) {
 	l.log(LevelInfo, message, properties)
 }
@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9@._-]+`)
+
+// File writes every message as an .eml file into a directory, where mail
+// clients can open it.
+type File struct {
+	dir string
+}
+
+func NewFile(dir string) *File {
+	return &File{dir: dir}
+}
+
+func (m *File) Deliver(msg *Message) error {
+	err := os.MkdirAll(m.dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	// Written under a temporary name first so that watchers never pick up a
+	// half written file.
+	tmp, err := os.CreateTemp(m.dir, ".mail-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = msg.mime().WriteTo(tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", msg.CreatedAt.Format("20060102T150405.000000000"), unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	return os.Rename(tmp.Name(), filepath.Join(m.dir, name))
+}
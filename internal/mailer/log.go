@@ -0,0 +1,26 @@
+package mailer
+
+import (
+	"openmovies/internal/jsonlog"
+)
+
+// Log writes messages to the application log instead of sending them.
+type Log struct {
+	logger *jsonlog.Logger
+}
+
+func NewLog(logger *jsonlog.Logger) *Log {
+	return &Log{logger: logger}
+}
+
+func (m *Log) Deliver(msg *Message) error {
+	m.logger.LogInfo("mail not sent, logged", map[string]string{
+		"from":     msg.From,
+		"to":       msg.To,
+		"subject":  msg.Subject,
+		"template": msg.Template,
+		"locale":   msg.Locale,
+		"body":     msg.PlainBody,
+	})
+	return nil
+}
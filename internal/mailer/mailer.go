@@ -1,65 +1,88 @@
 package mailer
 
 import (
-	"bytes"
 	"embed"
+	"errors"
 	"github.com/go-mail/mail"
-	"html/template"
+	"net/textproto"
+	"strings"
+	"time"
 )
 
 //go:embed "templates"
 var templateFS embed.FS
 
-type Mailer struct {
-	dialer *mail.Dialer
-	sender string
+// Mailer sends a templated email to one recipient, in the variant of the
+// template best matching locale.
+type Mailer interface {
+	Send(recipient string, locale string, templateName string, data any) error
 }
 
-func New(host string, port int, username, password, sender string) Mailer {
-	dialer := mail.NewDialer(host, port, username, password)
-	//dialer.Timeout = 5 * time.Second
+// Transport hands a rendered message over for delivery.
+type Transport interface {
+	Deliver(msg *Message) error
+}
 
-	return Mailer{
-		dialer: dialer,
-		sender: sender,
-	}
+// Message is a rendered email.
+type Message struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Subject   string    `json:"subject"`
+	PlainBody string    `json:"plainBody"`
+	HTMLBody  string    `json:"htmlBody"`
+	Template  string    `json:"template"`
+	Locale    string    `json:"locale"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Transactional mail is sent whether or not the recipient unsubscribed.
+	Transactional bool `json:"transactional"`
+	// UnsubscribeURL, when set, is announced in the List-Unsubscribe header
+	// and accepts one-click unsubscribe requests.
+	UnsubscribeURL string `json:"unsubscribeUrl,omitempty"`
 }
 
-func (m Mailer) Send(recipient string, templateFiles string, data interface{}) error {
-	tpl, err := template.New("mail").ParseFS(templateFS, "templates/"+templateFiles)
-	if err != nil {
-		return err
+// mime builds the MIME message for msg.
+func (msg *Message) mime() *mail.Message {
+	m := mail.NewMessage()
+	m.SetHeader("To", msg.To)
+	m.SetHeader("From", msg.From)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetDateHeader("Date", msg.CreatedAt)
+	if msg.Locale != "" {
+		m.SetHeader("Content-Language", msg.Locale)
 	}
-
-	subject := new(bytes.Buffer)
-	err = tpl.ExecuteTemplate(subject, "subject", data)
-	if err != nil {
-		return err
+	if msg.UnsubscribeURL != "" {
+		m.SetHeader("List-Unsubscribe", "<"+msg.UnsubscribeURL+">")
+		m.SetHeader("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
 	}
+	m.SetBody("text/plain", msg.PlainBody)
+	m.AddAlternative("text/html", msg.HTMLBody)
+	return m
+}
 
-	plainBody := new(bytes.Buffer)
-	err = tpl.ExecuteTemplate(plainBody, "plainBody", data)
-	if err != nil {
-		return err
-	}
+// Domain returns the lower cased domain part of address.
+func Domain(address string) string {
+	at := strings.LastIndexByte(address, '@')
+	return strings.ToLower(strings.TrimSuffix(address[at+1:], ">"))
+}
 
-	htmlBody := new(bytes.Buffer)
-	err = tpl.ExecuteTemplate(htmlBody, "htmlBody", data)
-	if err != nil {
-		return err
+// Classify tells apart delivery errors worth retrying from permanent ones,
+// which the server answered with a 5xx reply. Bounced means the reply said
+// the mailbox does not exist or cannot take mail, so sending to it again is
+// pointless.
+func Classify(err error) (permanent bool, bounced bool) {
+	var sendErr *mail.SendError
+	if errors.As(err, &sendErr) {
+		// SendError does not unwrap.
+		err = sendErr.Cause
 	}
-
-	msg := mail.NewMessage()
-	msg.SetHeader("To", recipient)
-	msg.SetHeader("From", m.sender)
-	msg.SetHeader("Subject", subject.String())
-	msg.SetBody("text/plain", plainBody.String())
-	msg.AddAlternative("text/html", htmlBody.String())
-
-	err = m.dialer.DialAndSend(msg)
-	if err != nil {
-		return err
+	var reply *textproto.Error
+	if !errors.As(err, &reply) || reply.Code < 500 {
+		return false, false
+	}
+	switch reply.Code {
+	case 550, 551, 553:
+		return true, true
+	default:
+		return true, false
 	}
-
-	return nil
 }
@@ -0,0 +1,42 @@
+package mailer
+
+import (
+	"sync"
+)
+
+// Memory keeps the most recent messages in memory so that they can be
+// inspected during development and in tests.
+type Memory struct {
+	limit    int
+	mu       sync.Mutex
+	messages []*Message
+}
+
+// NewMemory returns a Memory keeping the last limit messages.
+func NewMemory(limit int) *Memory {
+	return &Memory{limit: limit}
+}
+
+func (m *Memory) Deliver(msg *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	if len(m.messages) > m.limit {
+		m.messages = m.messages[len(m.messages)-m.limit:]
+	}
+	return nil
+}
+
+// Messages returns the captured messages, oldest first.
+func (m *Memory) Messages() []*Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*Message{}, m.messages...)
+}
+
+// Reset forgets every captured message.
+func (m *Memory) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
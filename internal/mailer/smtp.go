@@ -0,0 +1,24 @@
+package mailer
+
+import (
+	"github.com/go-mail/mail"
+	"time"
+)
+
+// SMTP delivers mail through an SMTP server.
+type SMTP struct {
+	dialer *mail.Dialer
+}
+
+func NewSMTP(host string, port int, username, password string) *SMTP {
+	dialer := mail.NewDialer(host, port, username, password)
+	dialer.Timeout = 10 * time.Second
+
+	return &SMTP{
+		dialer: dialer,
+	}
+}
+
+func (m *SMTP) Deliver(msg *Message) error {
+	return m.dialer.DialAndSend(msg.mime())
+}
@@ -0,0 +1,264 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"golang.org/x/text/language"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// DefaultLocale is the language of template files without a locale suffix.
+const DefaultLocale = "en"
+
+const layoutFile = "templates/layouts/base.tmpl"
+
+// Template names, each rendered with the data type registered for it below.
+const (
+	UserWelcome = "user_welcome"
+)
+
+type UserWelcomeData struct {
+	Name            string
+	UserID          int64
+	ActivationToken string
+}
+
+// registry ties every template to its data type through a sample value,
+// which validation and previews render with.
+var registry = map[string]any{
+	UserWelcome: UserWelcomeData{
+		Name:            "Ada Lovelace",
+		UserID:          42,
+		ActivationToken: "Zm9vYmFyK2Jhei9xdXV4PQ==",
+	},
+}
+
+// transactional lists the templates a recipient cannot unsubscribe from,
+// because they answer something the recipient did. Any other template is
+// held back once its recipient unsubscribes.
+var transactional = map[string]bool{
+	UserWelcome: true,
+}
+
+// variant is one locale of a template. Subject and plain text go through
+// text/template, which unlike html/template leaves tokens and URLs alone.
+type variant struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+type entry struct {
+	dataType reflect.Type
+	sample   any
+	locales  []string
+	matcher  language.Matcher
+	variants map[string]*variant
+}
+
+// Templates holds every mail template parsed and checked once, at startup.
+type Templates struct {
+	entries map[string]*entry
+}
+
+// TemplateInfo describes a registered template.
+type TemplateInfo struct {
+	Name    string   `json:"name"`
+	Locales []string `json:"locales"`
+}
+
+// LoadTemplates parses the embedded templates. A template is the file
+// templates/<name>.tmpl in the default locale plus a templates/<name>.<locale>.tmpl
+// file per translation, each defining subject, plainBody and htmlBody and
+// optionally overriding the greeting and signature of the shared layout.
+// Every variant is rendered with its sample data, so a template using a
+// field its data type lacks fails here rather than when mail goes out.
+func LoadTemplates() (*Templates, error) {
+	return loadTemplates(templateFS)
+}
+
+func loadTemplates(fsys fs.FS) (*Templates, error) {
+	layout, err := fs.ReadFile(fsys, layoutFile)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Templates{entries: map[string]*entry{}}
+	for name, sample := range registry {
+		files, err := fs.Glob(fsys, "templates/"+name+"*.tmpl")
+		if err != nil {
+			return nil, err
+		}
+		e := &entry{
+			dataType: reflect.TypeOf(sample),
+			sample:   sample,
+			variants: map[string]*variant{},
+		}
+		for _, file := range files {
+			locale, ok := fileLocale(name, path.Base(file))
+			if !ok {
+				continue
+			}
+			src, err := fs.ReadFile(fsys, file)
+			if err != nil {
+				return nil, err
+			}
+			v, err := parseVariant(file, string(layout), string(src))
+			if err != nil {
+				return nil, err
+			}
+			if _, err = v.render(sample); err != nil {
+				return nil, fmt.Errorf("mailer: %s: %w", file, err)
+			}
+			e.variants[locale] = v
+		}
+		if e.variants[DefaultLocale] == nil {
+			return nil, fmt.Errorf("mailer: template %s has no %s.tmpl", name, name)
+		}
+
+		// The default locale goes first so that the matcher falls back to it.
+		e.locales = []string{DefaultLocale}
+		for locale := range e.variants {
+			if locale != DefaultLocale {
+				e.locales = append(e.locales, locale)
+			}
+		}
+		slices.Sort(e.locales[1:])
+		tags := make([]language.Tag, len(e.locales))
+		for i, locale := range e.locales {
+			tags[i] = language.Make(locale)
+		}
+		e.matcher = language.NewMatcher(tags)
+		t.entries[name] = e
+	}
+	return t, nil
+}
+
+// fileLocale tells the locale of file, a template file of name.
+func fileLocale(name, file string) (string, bool) {
+	rest, ok := strings.CutPrefix(strings.TrimSuffix(file, ".tmpl"), name)
+	switch {
+	case !ok:
+		return "", false
+	case rest == "":
+		return DefaultLocale, true
+	case strings.HasPrefix(rest, "."):
+		tag, err := language.Parse(rest[1:])
+		if err != nil {
+			return "", false
+		}
+		return tag.String(), true
+	default:
+		// Another template sharing the prefix, such as user_welcome_back.
+		return "", false
+	}
+}
+
+func parseVariant(file, layout, src string) (*variant, error) {
+	text, err := texttemplate.New(file).Option("missingkey=error").Parse(layout)
+	if err == nil {
+		_, err = text.Parse(src)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mailer: %w", err)
+	}
+	html, err := htmltemplate.New(file).Option("missingkey=error").Parse(layout)
+	if err == nil {
+		_, err = html.Parse(src)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mailer: %w", err)
+	}
+	return &variant{text: text, html: html}, nil
+}
+
+func (v *variant) render(data any) (*Message, error) {
+	subject := new(bytes.Buffer)
+	err := v.text.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return nil, err
+	}
+
+	plainBody := new(bytes.Buffer)
+	err = v.text.ExecuteTemplate(plainBody, "plain", data)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	err = v.html.ExecuteTemplate(htmlBody, "html", data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		Subject:   strings.TrimSpace(subject.String()),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// Render renders template name in the variant best matching locale, which
+// may be empty, into a message from sender to recipient. data must be of the
+// type registered for the template.
+func (t *Templates) Render(sender, recipient, locale, name string, data any) (*Message, error) {
+	e, ok := t.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("mailer: unknown template %q", name)
+	}
+	if reflect.TypeOf(data) != e.dataType {
+		return nil, fmt.Errorf("mailer: template %s needs %s data, got %T", name, e.dataType, data)
+	}
+
+	chosen := DefaultLocale
+	if locale != "" {
+		_, index, confidence := e.matcher.Match(language.Make(locale))
+		if confidence != language.No {
+			chosen = e.locales[index]
+		}
+	}
+	msg, err := e.variants[chosen].render(data)
+	if err != nil {
+		return nil, err
+	}
+	msg.From = sender
+	msg.To = recipient
+	msg.Template = name
+	msg.Locale = chosen
+	msg.Transactional = transactional[name]
+	return msg, nil
+}
+
+// Preview renders template name with its sample data.
+func (t *Templates) Preview(name, locale string) (*Message, error) {
+	e, ok := t.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("mailer: unknown template %q", name)
+	}
+	return t.Render("", "", locale, name, e.sample)
+}
+
+// List describes every template, sorted by name.
+func (t *Templates) List() []TemplateInfo {
+	infos := make([]TemplateInfo, 0, len(t.entries))
+	for name, e := range t.entries {
+		infos = append(infos, TemplateInfo{Name: name, Locales: e.locales})
+	}
+	slices.SortFunc(infos, func(a, b TemplateInfo) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return infos
+}
+
+// Has reports whether name is a registered template.
+func (t *Templates) Has(name string) bool {
+	_, ok := t.entries[name]
+	return ok
+}
@@ -0,0 +1,40 @@
+package mailer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+// UnsubscribeToken signs email with secret, so that an unsubscribe link only
+// ever works for the address it was sent to.
+func UnsubscribeToken(secret string, email string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(email))
+	return base64.RawURLEncoding.EncodeToString([]byte(email)) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyUnsubscribeToken returns the address token was issued for, or false
+// when it was not signed with secret.
+func VerifyUnsubscribeToken(secret string, token string) (string, bool) {
+	encodedEmail, encodedMAC, found := strings.Cut(token, ".")
+	if !found {
+		return "", false
+	}
+	email, err := base64.RawURLEncoding.DecodeString(encodedEmail)
+	if err != nil {
+		return "", false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil {
+		return "", false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(email)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return "", false
+	}
+	return string(email), true
+}
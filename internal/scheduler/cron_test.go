@@ -0,0 +1,106 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+// after is a Friday.
+var after = time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+
+func TestParseNext(t *testing.T) {
+	tests := []struct {
+		spec  string
+		after time.Time
+		want  time.Time
+	}{
+		{"*/15 * * * *", after, time.Date(2024, 3, 15, 10, 45, 0, 0, time.UTC)},
+		{"5,10 * * * *", after, time.Date(2024, 3, 15, 11, 5, 0, 0, time.UTC)},
+		{"30 10 * * *", after, time.Date(2024, 3, 16, 10, 30, 0, 0, time.UTC)},
+		{"30 10 * * *", after.Add(-time.Second), after},
+		{"0 9-17/4 * * 1-5", after, time.Date(2024, 3, 15, 13, 0, 0, 0, time.UTC)},
+		{"0 9-17/4 * * 1-5", time.Date(2024, 3, 15, 17, 0, 0, 0, time.UTC), time.Date(2024, 3, 18, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", after, time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 */3 *", after, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either one matching is enough.
+		{"0 0 13 * 5", after, time.Date(2024, 3, 22, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 1", after, time.Date(2024, 3, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", after, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", after, time.Time{}},
+		{"@hourly", after, time.Date(2024, 3, 15, 11, 0, 0, 0, time.UTC)},
+		{"@daily", after, time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", after, time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", after, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", after, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 1h", after, time.Date(2024, 3, 15, 11, 0, 0, 0, time.UTC)},
+		{" 0 12 * * * ", after, time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)},
+		// Schedules are in UTC whatever the zone of the time passed in.
+		{"0 12 * * *", after.In(time.FixedZone("CEST", 2*60*60)), time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			schedule, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatalf("Parse(%q) error: %v", tt.spec, err)
+			}
+			got := schedule.Next(tt.after)
+			if !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.after, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	specs := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1- * * * *",
+		"-1 * * * *",
+		"1,,2 * * * *",
+		"@fortnightly",
+		"@every",
+		"@every soon",
+		"@every 30s",
+		"@every -1h",
+	}
+	for _, spec := range specs {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestEvery(t *testing.T) {
+	for _, d := range []time.Duration{0, -time.Minute} {
+		if _, err := Every(d); err == nil {
+			t.Errorf("Every(%s) succeeded, want an error", d)
+		}
+	}
+
+	d := 90 * time.Minute
+	schedule, err := Every(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slot := schedule.Next(after)
+	// Slots line up on multiples of d, so every replica picks the same ones.
+	if !slot.After(after) || slot.Sub(after) > d || !slot.Truncate(d).Equal(slot) {
+		t.Errorf("Next(%s) = %s, want the next multiple of %s", after, slot, d)
+	}
+	if next := schedule.Next(slot); !next.Equal(slot.Add(d)) {
+		t.Errorf("Next(%s) = %s, want %s", slot, next, slot.Add(d))
+	}
+}
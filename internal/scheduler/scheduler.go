@@ -0,0 +1,95 @@
+package scheduler
+
+import (
+	"context"
+	"openmovies/internal/jsonlog"
+	"sync"
+	"time"
+)
+
+// Func runs one scheduled job and describes what it did.
+type Func func(ctx context.Context) (string, error)
+
+// Runner runs fn for the slot of job name unless another replica holds the
+// job or already ran that slot, reporting whether fn ran.
+type Runner interface {
+	TryRun(ctx context.Context, name string, slot time.Time, fn func(ctx context.Context) (string, error)) (bool, string, error)
+}
+
+type job struct {
+	name     string
+	schedule Schedule
+	fn       Func
+}
+
+type Scheduler struct {
+	runner Runner
+	logger *jsonlog.Logger
+	jobs   []job
+}
+
+func New(runner Runner, logger *jsonlog.Logger) *Scheduler {
+	return &Scheduler{runner: runner, logger: logger}
+}
+
+func (s *Scheduler) Add(name string, schedule Schedule, fn Func) {
+	s.jobs = append(s.jobs, job{name: name, schedule: schedule, fn: fn})
+}
+
+// Run starts every job on its schedule and blocks until ctx is cancelled and
+// the runs in progress have returned.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, j := range s.jobs {
+		wg.Add(1)
+		go func(j job) {
+			defer wg.Done()
+			s.loop(ctx, j)
+		}(j)
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, j job) {
+	slot := j.schedule.Next(time.Now())
+	for !slot.IsZero() {
+		timer := time.NewTimer(time.Until(slot))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.run(ctx, j, slot)
+		// A run overlapping later slots skips them rather than catching up.
+		slot = j.schedule.Next(maxTime(slot, time.Now()))
+	}
+	s.logger.LogInfo("scheduled job never due", map[string]string{"job": j.name})
+}
+
+func (s *Scheduler) run(ctx context.Context, j job, slot time.Time) {
+	properties := map[string]string{
+		"job":  j.name,
+		"slot": slot.Format(time.RFC3339),
+	}
+	start := time.Now()
+	ran, outcome, err := s.runner.TryRun(ctx, j.name, slot, j.fn)
+	properties["duration"] = time.Since(start).String()
+	switch {
+	case err != nil:
+		s.logger.LogError(err, properties)
+	case !ran:
+		s.logger.LogDebug("scheduled job skipped, run elsewhere", properties)
+	default:
+		properties["outcome"] = outcome
+		s.logger.LogInfo("scheduled job finished", properties)
+	}
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
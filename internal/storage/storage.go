@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// Object describes a stored blob as returned by Get.
+type Object struct {
+	Body          io.ReadCloser
+	ContentType   string
+	ContentLength int64
+}
+
+// Storage keeps opaque blobs under slash separated keys.
+type Storage interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (*Object, error)
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,131 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-OpenMovies-Signature"
+	EventHeader     = "X-OpenMovies-Event"
+	DeliveryHeader  = "X-OpenMovies-Delivery"
+)
+
+// NewSecret returns a random signing secret for a new subscription.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign computes the signature header value for body sent at timestamp.
+// Receivers recompute the HMAC-SHA256 of "<t>.<body>" with their secret,
+// compare it to v1 and reject stale timestamps to stop replays.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%s,v1=%s", t, hex.EncodeToString(mac.Sum(nil)))
+}
+
+var ErrForbiddenAddress = errors.New("webhook address is not public")
+
+// sharedAddressSpace is 100.64.0.0/10, used for carrier grade NAT and by
+// some cloud metadata services, which netip does not count as private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// IsPublic reports whether deliveries may go to ip. Loopback, private,
+// link-local (cloud metadata endpoints included), unspecified and multicast
+// addresses all reach the server's own network rather than a subscriber.
+func IsPublic(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsValid() &&
+		!ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified() &&
+		!sharedAddressSpace.Contains(ip) &&
+		!(ip.Is4() && ip.As4()[0] == 0)
+}
+
+// NewClient returns the client deliveries are sent with. Unless
+// allowPrivate is set it refuses to connect to addresses that are not
+// public. The check runs on the address actually dialled, after name
+// resolution and on every redirect, so DNS cannot be used to slip past it.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !IsPublic(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, addrPort.Addr())
+			}
+			return nil
+		}
+	}
+	// No proxy: the dialled address has to be the subscriber's.
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: timeout,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+type Request struct {
+	URL        string
+	Secret     string
+	DeliveryID int64
+	EventType  string
+	Body       []byte
+}
+
+// Send posts a signed delivery and returns the response status. Anything
+// but a 2xx answer is reported as an error.
+func Send(ctx context.Context, client *http.Client, r Request) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, bytes.NewReader(r.Body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "openmovies-webhooks/1.0")
+	req.Header.Set(EventHeader, r.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(r.DeliveryID, 10))
+	req.Header.Set(SignatureHeader, Sign(r.Secret, time.Now(), r.Body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS movie_revisions
+(
+    id         bigserial PRIMARY KEY,
+    movie_id   bigint                      NOT NULL,
+    version    integer                     NOT NULL,
+    action     text                        NOT NULL,
+    user_id    bigint                      REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    snapshot   jsonb                       NOT NULL,
+    diff       jsonb                       NOT NULL DEFAULT '{}'
+);
+CREATE INDEX IF NOT EXISTS movie_revisions_movie_id_idx ON movie_revisions (movie_id, version);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS movies_deleted_at_idx;
+DELETE FROM movies WHERE deleted_at IS NOT NULL;
+ALTER TABLE movies
+    DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,3 @@
+ALTER TABLE movies
+    ADD COLUMN IF NOT EXISTS updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+UPDATE movies SET updated_at = created_at;
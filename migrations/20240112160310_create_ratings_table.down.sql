@@ -0,0 +1,5 @@
+DELETE FROM permissions WHERE code = 'ratings:write';
+ALTER TABLE movies
+    DROP COLUMN IF EXISTS rating,
+    DROP COLUMN IF EXISTS rating_count;
+DROP TABLE IF EXISTS ratings;
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE code IN ('reviews:write', 'reviews:moderate');
+DROP TABLE IF EXISTS review_flags;
+DROP TABLE IF EXISTS reviews;
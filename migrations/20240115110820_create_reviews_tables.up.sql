@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS reviews
+(
+    id              bigserial PRIMARY KEY,
+    movie_id        bigint                      NOT NULL REFERENCES movies ON DELETE CASCADE,
+    user_id         bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    title           text                        NOT NULL,
+    body            text                        NOT NULL,
+    status          text                        NOT NULL DEFAULT 'pending',
+    flag_count      integer                     NOT NULL DEFAULT 0,
+    moderated_by    bigint                      REFERENCES users ON DELETE SET NULL,
+    moderated_at    timestamp(0) with time zone,
+    moderation_note text                        NOT NULL DEFAULT '',
+    created_at      timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at      timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version         integer                     NOT NULL DEFAULT 1,
+    CONSTRAINT reviews_status_check CHECK (status IN ('pending', 'approved', 'hidden', 'rejected'))
+);
+CREATE INDEX IF NOT EXISTS reviews_movie_id_idx ON reviews (movie_id, status);
+CREATE INDEX IF NOT EXISTS reviews_moderation_idx ON reviews (status, flag_count);
+
+CREATE TABLE IF NOT EXISTS review_flags
+(
+    review_id  bigint                      NOT NULL REFERENCES reviews ON DELETE CASCADE,
+    user_id    bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    reason     text                        NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (review_id, user_id)
+);
+
+INSERT INTO permissions (code)
+VALUES ('reviews:write'),
+       ('reviews:moderate');
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS lists
+(
+    id          bigserial PRIMARY KEY,
+    user_id     bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    name        text                        NOT NULL,
+    description text                        NOT NULL DEFAULT '',
+    visibility  text                        NOT NULL DEFAULT 'private',
+    share_token text                        NOT NULL UNIQUE,
+    created_at  timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at  timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version     integer                     NOT NULL DEFAULT 1,
+    CONSTRAINT lists_visibility_check CHECK (visibility IN ('private', 'unlisted', 'public'))
+);
+CREATE INDEX IF NOT EXISTS lists_user_id_idx ON lists (user_id);
+
+-- Items follow the movie lifecycle: trashed movies are filtered out when a
+-- list is read and come back on restore, purged movies cascade away.
+CREATE TABLE IF NOT EXISTS list_items
+(
+    list_id  bigint                      NOT NULL REFERENCES lists ON DELETE CASCADE,
+    movie_id bigint                      NOT NULL REFERENCES movies ON DELETE CASCADE,
+    position integer                     NOT NULL,
+    note     text                        NOT NULL DEFAULT '',
+    added_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (list_id, movie_id)
+);
+CREATE INDEX IF NOT EXISTS list_items_movie_id_idx ON list_items (movie_id);
@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS genres
+(
+    id         bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    slug       text UNIQUE                 NOT NULL,
+    name       text                        NOT NULL,
+    aliases    text[]                      NOT NULL DEFAULT '{}',
+    version    integer                     NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS genres_aliases_idx ON genres USING GIN (aliases);
+
+-- Seed the taxonomy from the free-text values already in use. Values that only
+-- differ in case or punctuation collapse into one slug, and every original
+-- spelling is kept as a lower-cased alias.
+WITH normalised AS (SELECT DISTINCT genre                                                            AS name,
+                                    trim(BOTH '-' FROM regexp_replace(lower(genre), '[^a-z0-9]+', '-', 'g')) AS slug
+                    FROM movies, unnest(movies.genres) AS genre)
+INSERT
+INTO genres (slug, name, aliases)
+SELECT slug, min(name), array_agg(DISTINCT lower(name))
+FROM normalised
+WHERE slug <> ''
+GROUP BY slug
+ON CONFLICT (slug) DO NOTHING;
+
+UPDATE movies
+SET genres = ARRAY(SELECT genres.slug
+                   FROM unnest(movies.genres) WITH ORDINALITY AS original(name, position)
+                            INNER JOIN genres ON lower(original.name) = ANY (genres.aliases)
+                   GROUP BY genres.slug
+                   ORDER BY min(original.position));
+
+INSERT INTO permissions (code)
+VALUES ('genres:write');
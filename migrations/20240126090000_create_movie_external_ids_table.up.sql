@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS movie_external_ids
+(
+    source      text   NOT NULL,
+    external_id text   NOT NULL,
+    movie_id    bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    PRIMARY KEY (source, external_id),
+    CONSTRAINT movie_external_ids_movie_source_key UNIQUE (movie_id, source)
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS movie_redirects;
+DROP INDEX IF EXISTS movies_normalized_title_idx;
+ALTER TABLE movies
+    DROP COLUMN IF EXISTS normalized_title;
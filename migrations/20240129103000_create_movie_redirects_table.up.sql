@@ -0,0 +1,15 @@
+ALTER TABLE movies
+    ADD COLUMN IF NOT EXISTS normalized_title text GENERATED ALWAYS AS (
+        regexp_replace(regexp_replace(lower(title), '^(the|a|an)\s+', ''), '[^[:alnum:]]+', '', 'g')
+        ) STORED;
+CREATE INDEX IF NOT EXISTS movies_normalized_title_idx ON movies (normalized_title, year);
+
+-- A redirect survives as long as the movie it points at, merging that movie
+-- again repoints its redirects so lookups never need to follow a chain.
+CREATE TABLE IF NOT EXISTS movie_redirects
+(
+    old_id     bigint PRIMARY KEY,
+    movie_id   bigint                      NOT NULL REFERENCES movies ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS movie_redirects_movie_id_idx ON movie_redirects (movie_id);
@@ -0,0 +1,14 @@
+-- Every locale has at most one display title and any number of alternate
+-- titles. search_config is the text search configuration matching the
+-- locale's language, chosen by the application when the row is written.
+CREATE TABLE IF NOT EXISTS movie_titles
+(
+    movie_id      bigint    NOT NULL REFERENCES movies ON DELETE CASCADE,
+    locale        text      NOT NULL,
+    title         text      NOT NULL,
+    alternate     boolean   NOT NULL DEFAULT false,
+    search_config regconfig NOT NULL DEFAULT 'simple',
+    PRIMARY KEY (movie_id, locale, title)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS movie_titles_display_idx ON movie_titles (movie_id, locale) WHERE NOT alternate;
+CREATE INDEX IF NOT EXISTS movie_titles_search_idx ON movie_titles USING GIN (to_tsvector(search_config, title));
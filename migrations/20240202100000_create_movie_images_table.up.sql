@@ -0,0 +1,15 @@
+-- Purging a movie detaches its images instead of deleting them, so the
+-- trash purge job can still find and remove their stored files.
+CREATE TABLE IF NOT EXISTS movie_images
+(
+    id           bigserial PRIMARY KEY,
+    movie_id     bigint REFERENCES movies ON DELETE SET NULL,
+    kind         text                        NOT NULL,
+    content_type text                        NOT NULL,
+    width        integer                     NOT NULL,
+    height       integer                     NOT NULL,
+    size         bigint                      NOT NULL,
+    created_at   timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    CONSTRAINT movie_images_kind_check CHECK (kind IN ('poster', 'backdrop', 'still'))
+);
+CREATE INDEX IF NOT EXISTS movie_images_movie_id_idx ON movie_images (movie_id);
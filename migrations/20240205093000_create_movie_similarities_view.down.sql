@@ -0,0 +1,2 @@
+DROP MATERIALIZED VIEW IF EXISTS movie_similarities;
+DROP FUNCTION IF EXISTS array_jaccard(anyarray, anyarray);
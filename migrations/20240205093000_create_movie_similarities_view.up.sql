@@ -0,0 +1,42 @@
+CREATE OR REPLACE FUNCTION array_jaccard(a anyarray, b anyarray) RETURNS double precision
+    LANGUAGE sql
+    IMMUTABLE AS
+$$
+SELECT COALESCE(
+               cardinality(ARRAY(SELECT unnest(a) INTERSECT SELECT unnest(b)))::double precision /
+               NULLIF(cardinality(ARRAY(SELECT unnest(a) UNION SELECT unnest(b))), 0), 0)
+$$;
+
+-- Component scores between 0 and 1 for every pair of live movies sharing a
+-- genre or a person. Weights are applied when the view is queried, so they
+-- can change without a refresh.
+CREATE MATERIALIZED VIEW IF NOT EXISTS movie_similarities AS
+WITH live AS (SELECT id,
+                     year,
+                     genres,
+                     array_remove(regexp_split_to_array(lower(title), '[^[:alnum:]]+'), '') AS words
+              FROM movies
+              WHERE deleted_at IS NULL),
+     people AS (SELECT movie_id, array_agg(DISTINCT person_id) AS ids
+                FROM credits
+                GROUP BY movie_id),
+     pairs AS (SELECT a.id AS movie_id, b.id AS similar_id
+               FROM live a
+                        INNER JOIN live b ON b.id <> a.id AND b.genres && a.genres
+               UNION
+               SELECT a.movie_id, b.movie_id
+               FROM credits a
+                        INNER JOIN credits b ON b.person_id = a.person_id AND b.movie_id <> a.movie_id)
+SELECT pairs.movie_id,
+       pairs.similar_id,
+       array_jaccard(a.genres, b.genres)                           AS genre_score,
+       GREATEST(0, 1 - abs(a.year - b.year) / 20.0)::double precision AS year_score,
+       array_jaccard(COALESCE(pa.ids, '{}'), COALESCE(pb.ids, '{}')) AS people_score,
+       array_jaccard(a.words, b.words)                             AS title_score
+FROM pairs
+         INNER JOIN live a ON a.id = pairs.movie_id
+         INNER JOIN live b ON b.id = pairs.similar_id
+         LEFT JOIN people pa ON pa.movie_id = pairs.movie_id
+         LEFT JOIN people pb ON pb.movie_id = pairs.similar_id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS movie_similarities_pair_idx ON movie_similarities (movie_id, similar_id);
@@ -0,0 +1,10 @@
+-- Item-item neighbours derived from co-ratings, rebuilt wholesale by the
+-- recommendations job.
+CREATE TABLE IF NOT EXISTS movie_neighbours
+(
+    movie_id     bigint           NOT NULL REFERENCES movies ON DELETE CASCADE,
+    neighbour_id bigint           NOT NULL REFERENCES movies ON DELETE CASCADE,
+    similarity   double precision NOT NULL,
+    co_ratings   integer          NOT NULL,
+    PRIMARY KEY (movie_id, neighbour_id)
+);
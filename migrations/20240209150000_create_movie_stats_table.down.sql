@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE code = 'stats:read';
+DROP TABLE IF EXISTS movie_stats;
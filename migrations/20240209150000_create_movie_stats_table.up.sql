@@ -0,0 +1,13 @@
+-- Hourly counters, written in batches by the API's stats collector.
+CREATE TABLE IF NOT EXISTS movie_stats
+(
+    movie_id    bigint                      NOT NULL REFERENCES movies ON DELETE CASCADE,
+    bucket      timestamp(0) with time zone NOT NULL,
+    views       bigint                      NOT NULL DEFAULT 0,
+    search_hits bigint                      NOT NULL DEFAULT 0,
+    PRIMARY KEY (movie_id, bucket)
+);
+CREATE INDEX IF NOT EXISTS movie_stats_bucket_idx ON movie_stats (bucket);
+
+INSERT INTO permissions (code)
+VALUES ('stats:read');
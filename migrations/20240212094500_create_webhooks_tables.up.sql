@@ -0,0 +1,41 @@
+-- movie_events is the outbox: rows are written in the same transaction as
+-- the change they describe.
+CREATE TABLE IF NOT EXISTS movie_events
+(
+    id         bigserial PRIMARY KEY,
+    type       text                        NOT NULL,
+    movie_id   bigint                      NOT NULL,
+    payload    jsonb                       NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS webhooks
+(
+    id         bigserial PRIMARY KEY,
+    url        text                        NOT NULL,
+    secret     text                        NOT NULL,
+    events     text[]                      NOT NULL,
+    active     boolean                     NOT NULL DEFAULT true,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version    integer                     NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id              bigserial PRIMARY KEY,
+    webhook_id      bigint                      NOT NULL REFERENCES webhooks ON DELETE CASCADE,
+    event_id        bigint                      NOT NULL REFERENCES movie_events ON DELETE CASCADE,
+    status          text                        NOT NULL DEFAULT 'pending',
+    attempts        integer                     NOT NULL DEFAULT 0,
+    next_attempt_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_attempt_at timestamp(0) with time zone,
+    response_status integer,
+    last_error      text                        NOT NULL DEFAULT '',
+    created_at      timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    CONSTRAINT webhook_deliveries_status_check CHECK (status IN ('pending', 'failed', 'succeeded', 'dead'))
+);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status IN ('pending', 'failed');
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id, id);
+
+INSERT INTO permissions (code)
+VALUES ('webhooks:manage');
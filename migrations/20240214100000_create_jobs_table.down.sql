@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE code = 'jobs:manage';
+DROP TABLE IF EXISTS jobs;
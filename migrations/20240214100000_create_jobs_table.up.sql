@@ -0,0 +1,24 @@
+-- Work run by the API's job workers. A job is claimed by moving it to
+-- running with a lease; a worker that dies leaves the lease to run out so
+-- another one picks the job up again.
+CREATE TABLE IF NOT EXISTS jobs
+(
+    id           bigserial PRIMARY KEY,
+    kind         text                        NOT NULL,
+    payload      jsonb                       NOT NULL,
+    status       text                        NOT NULL DEFAULT 'pending',
+    attempts     integer                     NOT NULL DEFAULT 0,
+    max_attempts integer                     NOT NULL,
+    run_at       timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    locked_until timestamp(0) with time zone,
+    last_error   text                        NOT NULL DEFAULT '',
+    created_at   timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    finished_at  timestamp(0) with time zone,
+    CONSTRAINT jobs_status_check CHECK (status IN ('pending', 'running', 'failed', 'succeeded', 'dead'))
+);
+CREATE INDEX IF NOT EXISTS jobs_due_idx ON jobs (run_at) WHERE status IN ('pending', 'failed');
+CREATE INDEX IF NOT EXISTS jobs_locked_until_idx ON jobs (locked_until) WHERE status = 'running';
+CREATE INDEX IF NOT EXISTS jobs_status_idx ON jobs (status, id);
+
+INSERT INTO permissions (code)
+VALUES ('jobs:manage');
@@ -0,0 +1,10 @@
+-- The last slot each scheduled job was started for, so a slot runs on one
+-- replica only even when another one gets to it after the first finished.
+CREATE TABLE IF NOT EXISTS scheduled_jobs
+(
+    name        text PRIMARY KEY,
+    slot        timestamp(0) with time zone NOT NULL,
+    started_at  timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    finished_at timestamp(0) with time zone,
+    last_error  text                        NOT NULL DEFAULT ''
+);
@@ -0,0 +1,2 @@
+-- The language the user prefers mail in, empty when unknown.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale text NOT NULL DEFAULT '';
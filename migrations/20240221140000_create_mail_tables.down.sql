@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE code = 'mail:manage';
+DROP TABLE IF EXISTS mail_suppressions;
+DROP TABLE IF EXISTS mail_messages;
@@ -0,0 +1,37 @@
+-- Outgoing mail, rendered when queued so that retries and resends send
+-- exactly what was queued.
+CREATE TABLE IF NOT EXISTS mail_messages
+(
+    id              bigserial PRIMARY KEY,
+    sender          text                        NOT NULL,
+    recipient       citext                      NOT NULL,
+    template        text                        NOT NULL,
+    locale          text                        NOT NULL,
+    subject         text                        NOT NULL,
+    plain_body      text                        NOT NULL,
+    html_body       text                        NOT NULL,
+    status          text                        NOT NULL DEFAULT 'queued',
+    attempts        integer                     NOT NULL DEFAULT 0,
+    next_attempt_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_attempt_at timestamp(0) with time zone,
+    last_error      text                        NOT NULL DEFAULT '',
+    created_at      timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    sent_at         timestamp(0) with time zone,
+    CONSTRAINT mail_messages_status_check CHECK (status IN ('queued', 'failed', 'sent', 'dead', 'suppressed'))
+);
+CREATE INDEX IF NOT EXISTS mail_messages_due_idx ON mail_messages (next_attempt_at) WHERE status IN ('queued', 'failed');
+CREATE INDEX IF NOT EXISTS mail_messages_recipient_idx ON mail_messages (recipient);
+CREATE INDEX IF NOT EXISTS mail_messages_status_idx ON mail_messages (status, id);
+
+-- Addresses no mail is sent to.
+CREATE TABLE IF NOT EXISTS mail_suppressions
+(
+    email      citext PRIMARY KEY,
+    reason     text                        NOT NULL,
+    detail     text                        NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    CONSTRAINT mail_suppressions_reason_check CHECK (reason IN ('bounce', 'unsubscribe', 'complaint', 'manual'))
+);
+
+INSERT INTO permissions (code)
+VALUES ('mail:manage');
@@ -0,0 +1,8 @@
+-- The sci-fi genres merged by the up migration stay merged.
+ALTER TABLE genres
+    ADD COLUMN IF NOT EXISTS aliases text[] NOT NULL DEFAULT '{}';
+UPDATE genres
+SET aliases = ARRAY(SELECT alias FROM genre_aliases WHERE genre_id = genres.id ORDER BY alias);
+CREATE INDEX IF NOT EXISTS genres_aliases_idx ON genres USING GIN (aliases);
+
+DROP TABLE IF EXISTS genre_aliases;
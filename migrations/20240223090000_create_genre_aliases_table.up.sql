@@ -0,0 +1,50 @@
+-- Aliases move out of genres.aliases into their own table, keyed by the alias,
+-- so that one alias can only ever name one genre. An alias several genres
+-- claimed stays with the oldest of them.
+CREATE TABLE IF NOT EXISTS genre_aliases
+(
+    alias    text PRIMARY KEY,
+    genre_id bigint NOT NULL REFERENCES genres ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS genre_aliases_genre_id_idx ON genre_aliases (genre_id);
+
+INSERT INTO genre_aliases (alias, genre_id)
+SELECT DISTINCT ON (alias) alias, id
+FROM genres,
+     unnest(genres.aliases) AS alias
+ORDER BY alias, id
+ON CONFLICT (alias) DO NOTHING;
+
+-- The slug normalisation of the genres migration kept spellings such as
+-- "Sci-Fi" apart from "Science Fiction". Collapse them into one genre.
+INSERT INTO genres (slug, name)
+SELECT 'science-fiction', 'Science Fiction'
+WHERE EXISTS (SELECT 1 FROM genres WHERE slug IN ('sci-fi', 'scifi'))
+ON CONFLICT (slug) DO NOTHING;
+
+UPDATE movies
+SET genres     = ARRAY(SELECT CASE WHEN original.name IN ('sci-fi', 'scifi') THEN 'science-fiction' ELSE original.name END
+                       FROM unnest(movies.genres) WITH ORDINALITY AS original(name, position)
+                       GROUP BY 1
+                       ORDER BY min(original.position)),
+    version    = version + 1,
+    updated_at = NOW()
+WHERE genres && ARRAY ['sci-fi', 'scifi'];
+
+UPDATE genre_aliases
+SET genre_id = (SELECT id FROM genres WHERE slug = 'science-fiction')
+WHERE genre_id IN (SELECT id FROM genres WHERE slug IN ('sci-fi', 'scifi'));
+
+INSERT INTO genre_aliases (alias, genre_id)
+SELECT alias, genres.id
+FROM genres,
+     unnest(ARRAY ['sci-fi', 'scifi', 'science fiction']) AS alias
+WHERE genres.slug = 'science-fiction'
+ON CONFLICT (alias) DO UPDATE SET genre_id = EXCLUDED.genre_id;
+
+DELETE
+FROM genres
+WHERE slug IN ('sci-fi', 'scifi');
+
+ALTER TABLE genres
+    DROP COLUMN IF EXISTS aliases;
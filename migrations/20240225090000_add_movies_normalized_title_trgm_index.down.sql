@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS movies_normalized_title_trgm_idx;
+DROP EXTENSION IF EXISTS pg_trgm;
@@ -0,0 +1,3 @@
+-- Duplicate detection compares normalised titles by trigram similarity.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS movies_normalized_title_trgm_idx ON movies USING GIN (normalized_title gin_trgm_ops);
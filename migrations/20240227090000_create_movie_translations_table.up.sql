@@ -0,0 +1,10 @@
+-- Translated descriptive text of a movie, one row per locale. Titles live in
+-- movie_titles, since a locale can have several of them.
+CREATE TABLE IF NOT EXISTS movie_translations
+(
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    locale   text   NOT NULL,
+    tagline  text   NOT NULL DEFAULT '',
+    overview text   NOT NULL DEFAULT '',
+    PRIMARY KEY (movie_id, locale)
+);
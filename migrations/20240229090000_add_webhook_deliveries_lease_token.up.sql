@@ -0,0 +1,3 @@
+-- lease_token identifies the claim a delivery is being sent under, so an
+-- attempt that outlived its lease cannot overwrite the outcome of the next.
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS lease_token text;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS movie_events_txid_idx;
+ALTER TABLE movie_events DROP COLUMN IF EXISTS txid;
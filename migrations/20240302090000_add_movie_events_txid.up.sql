@@ -0,0 +1,6 @@
+-- txid is the transaction that logged the event. Ids are handed out before
+-- commit, so a stream resuming after an id also has to look at events of
+-- transactions that were still running when it last read the log.
+ALTER TABLE movie_events ADD COLUMN IF NOT EXISTS txid bigint NOT NULL DEFAULT 0;
+ALTER TABLE movie_events ALTER COLUMN txid SET DEFAULT pg_current_xact_id()::text::bigint;
+CREATE INDEX IF NOT EXISTS movie_events_txid_idx ON movie_events (txid);
@@ -0,0 +1,3 @@
+-- lease_token identifies the claim a message is being sent under, so an
+-- attempt that outlived its lease cannot overwrite the outcome of the next.
+ALTER TABLE mail_messages ADD COLUMN IF NOT EXISTS lease_token text;
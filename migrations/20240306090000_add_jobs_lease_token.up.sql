@@ -0,0 +1,3 @@
+-- lease_token identifies the claim a job is running under, so a run that
+-- outlived its lease cannot overwrite the outcome of the next.
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS lease_token text;
@@ -0,0 +1 @@
+ALTER TABLE mail_messages DROP COLUMN IF EXISTS transactional;
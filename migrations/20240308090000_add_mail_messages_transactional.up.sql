@@ -0,0 +1,5 @@
+-- Transactional mail, such as account activation, is only held back for
+-- addresses that bounce, never because the recipient unsubscribed.
+ALTER TABLE mail_messages ADD COLUMN IF NOT EXISTS transactional boolean NOT NULL DEFAULT false;
+
+UPDATE mail_messages SET transactional = true WHERE template = 'user_welcome';